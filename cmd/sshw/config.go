@@ -2,48 +2,160 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path"
 )
 
 func init() {
+	mergeCmd.Flags().Bool("dry-run", false, "print unified diff instead of writing config")
 	rootCmd.AddCommand(mergeCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "check config and print its schema",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "report problems of config with file and line, exit 1 if there is any",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		filename := rootCmd.PersistentFlags().Lookup("filename").Value.String()
+		diagnostics, err := sshwctl.ValidateYamlConfig(filename)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, diagnostic := range diagnostics {
+			fmt.Println(diagnostic)
+		}
+		if len(diagnostics) != 0 {
+			fmt.Printf("%d problems\n", len(diagnostics))
+			os.Exit(1)
+		}
+	},
 }
 
 var mergeCmd = &cobra.Command{
-	Use:   "merge",
-	Short: "merge config by name",
-	Args:  cobra.MinimumNArgs(1),
+	Use:   "merge <upstream>",
+	Short: "merge upstream config into config field by field",
+	Long: "merge upstream config into config field by field, comments of config are kept.\n" +
+		"upstream of last merge is the base of three-way merge, local changes are kept if both sides changed.\n" +
+		"without base, upstream is used. conflicts are reported",
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		dryRun := cmd.Flags().Lookup("dry-run").Value.String() == "true"
 		filename := rootCmd.PersistentFlags().Lookup("filename").Value.String()
-		if _, err := url.ParseRequestURI(filename); err == nil {
+		if uri, err := url.ParseRequestURI(filename); err == nil && uri.Host != "" {
 			fmt.Println("Can not merge config to remote config.")
 			return
 		}
-		pathname, dstNodes, err := sshwctl.LoadYamlConfig(filename)
+		pathname, b, err := sshwctl.ReadConfigBytes(filename)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
-		_, srcNodes, err := sshwctl.LoadYamlConfig(args[0])
+		if pathname == "" {
+			fmt.Println("config is not found")
+			return
+		}
+		local, err := sshwctl.ParseYamlDocuments(b)
 		if err != nil {
-			fmt.Println("load expected yaml", err)
+			fmt.Println(err)
 			return
 		}
-		sshwctl.MergeNodes(&dstNodes, srcNodes)
+		upstreamPathname, upstreamBytes, err := sshwctl.ReadConfigBytes(args[0])
+		if err != nil {
+			fmt.Println("load upstream yaml", err)
+			return
+		}
+		upstream, err := sshwctl.ParseYamlDocuments(upstreamBytes)
+		if err != nil {
+			fmt.Println("load upstream yaml", err)
+			return
+		}
+		basePath := sshwctl.MergeBasePath(pathname, upstreamPathname)
+		var base *sshwctl.YamlDocuments
+		if baseBytes, err := ioutil.ReadFile(basePath); err == nil {
+			if base, err = sshwctl.ParseYamlDocuments(baseBytes); err != nil {
+				fmt.Println("load merge base", err)
+				return
+			}
+		}
 
-		mergedNodes, err := yaml.Marshal(dstNodes)
+		report := sshwctl.MergeYamlDocuments(local, upstream, base)
+		merged, err := local.Bytes()
 		if err != nil {
 			fmt.Println("marshal merged config", err)
 			return
 		}
-		if err := backupAndReplaceFile(pathname, bytes.NewReader(mergedNodes)); err != nil {
+		printMergeReport(report)
+		if dryRun {
+			fmt.Print(unifiedDiff(b, merged, pathname))
+			return
+		}
+		if err := checkConfigBytes(merged); err != nil {
+			fmt.Println("merged config can not be loaded,", err)
+			return
+		}
+		if err := backupAndReplaceFile(pathname, bytes.NewReader(merged)); err != nil {
 			fmt.Println("replace config", err)
 			return
 		}
+		if err := os.MkdirAll(path.Dir(basePath), 0700); err == nil {
+			_ = ioutil.WriteFile(basePath, upstreamBytes, 0600)
+		}
 		fmt.Println("Merge finished")
 	},
 }
+
+func printMergeReport(report *sshwctl.MergeReport) {
+	for _, p := range report.Added {
+		fmt.Println("added " + p)
+	}
+	for _, p := range report.Removed {
+		fmt.Println("removed " + p)
+	}
+	for _, p := range report.Updated {
+		fmt.Println("updated " + p)
+	}
+	for _, conflict := range report.Conflicts {
+		fmt.Println("conflict " + conflict.String())
+	}
+}
+
+func unifiedDiff(a, b []byte, filename string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: filename,
+		ToFile:   filename + " (merged)",
+		Context:  3,
+	})
+	return diff
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "print json schema of config for yaml language servers",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(sshwctl.NodeSchema()); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
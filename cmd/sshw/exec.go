@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addTagFlag(execCmd)
+	execCmd.Flags().IntP("parallel", "p", 1, "number of nodes to run command on at the same time, nodes never prompt if it is greater than 1")
+	rootCmd.AddCommand(execCmd)
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec [alias or path] -- command",
+	Short: "run command on node of alias or every node matching --tag, output is prefixed by node",
+	Example: `sshw exec web1 -- uptime
+sshw exec --tag 'db && prod' -- df -h`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := NewNodesLoaderConfig()
+		conf.tags, _ = cmd.Flags().GetStringArray("tag")
+		aliases, command := args, []string(nil)
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			aliases, command = args[:dash], args[dash:]
+		} else if len(conf.tags) != 0 {
+			aliases, command = nil, args
+		} else {
+			aliases, command = args[:1], args[1:]
+		}
+		if len(command) == 0 {
+			fmt.Println("command is empty")
+			return
+		}
+		if len(aliases) == 0 && len(conf.tags) == 0 {
+			fmt.Println("alias or --tag is required")
+			return
+		}
+		nodes, err := NewNodes(conf)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		var targets []*sshwctl.Node
+		var names []string
+		if len(aliases) == 0 {
+			targets, names = sshwctl.LeafNodes(nodes)
+		}
+		for _, alias := range aliases {
+			node, err := resolveNode(nodes, alias)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			targets, names = append(targets, node), append(names, alias)
+		}
+		if len(targets) == 0 {
+			fmt.Println("no node matches")
+			return
+		}
+
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		if parallel < 1 {
+			parallel = 1
+		}
+		if err := execNodes(targets, names, strings.Join(command, " "), parallel); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// run command on nodes, lines of output are prefixed by names
+// nodes run at the same time are in batch mode, prompts of them would share one terminal
+func execNodes(nodes []*sshwctl.Node, names []string, command string, parallel int) error {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var failed []string
+	tokens := make(chan struct{}, parallel)
+	sshwctl.StartPlugins()
+	for i := range nodes {
+		node, name := execNode(nodes[i], parallel), names[i]
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			stdout := &sshwctl.PrefixWriter{W: os.Stdout, Prefix: name + ": ", Lock: &lock}
+			stderr := &sshwctl.PrefixWriter{W: os.Stderr, Prefix: name + ": ", Lock: &lock}
+			// messages of sshw go to stderr, stdout is output of command only
+			messages := &sshwctl.PrefixWriter{W: os.Stderr, Prefix: name + ": ", Lock: &lock}
+			node.Stdout = messages
+			err := sshwctl.RunCommand(node, command, stdout, stderr)
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+			_ = messages.Flush()
+			if err != nil {
+				lock.Lock()
+				failed = append(failed, name)
+				_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(failed) != 0 {
+		return fmt.Errorf("failed on %d of %d nodes: %s", len(failed), len(nodes), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// copy of node run by execNodes, nodes may share jump nodes which are rendered when they are connected
+func execNode(node *sshwctl.Node, parallel int) *sshwctl.Node {
+	node = sshwctl.CopyNode(node)
+	if parallel > 1 {
+		node.BatchMode = true
+		for _, jump := range node.Jump {
+			jump.BatchMode = true
+		}
+	}
+	return node
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_execNodesBatchMode(t *testing.T) {
+	ast := assert.New(t)
+	jump := &sshwctl.Node{Name: "jump"}
+	nodes := []*sshwctl.Node{{Name: "a", Jump: []*sshwctl.Node{jump}}, {Name: "b", Jump: []*sshwctl.Node{jump}}}
+	ast.False(execNode(nodes[0], 1).BatchMode)
+
+	// prompts of parallel nodes would share one terminal
+	node := execNode(nodes[0], 2)
+	ast.True(node.BatchMode)
+	ast.True(node.Jump[0].BatchMode)
+	// shared jump node is not written by goroutines of nodes
+	ast.NotNil(execNodes(nodes, []string{"a", "b"}, "true", 2))
+	ast.False(nodes[0].BatchMode)
+	ast.False(jump.BatchMode)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	exportSshConfigCmd.Flags().String("subtree", "", "only export nodes under bookmark, etc. prod or prod/web")
+	exportCmd.AddCommand(exportSshConfigCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export nodes for other tools",
+}
+
+var exportSshConfigCmd = &cobra.Command{
+	Use:   "ssh-config",
+	Short: "print resolved nodes as OpenSSH config, secrets are excluded",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		nodes, err := NewNodes(NewNodesLoaderConfig())
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		prefix := ""
+		if subtree := cmd.Flags().Lookup("subtree").Value.String(); subtree != "" {
+			node, parent, err := sshwctl.FindSubtree(nodes, subtree)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			nodes, prefix = []*sshwctl.Node{node}, parent
+		}
+		if err := sshwctl.ExportSshConfig(os.Stdout, nodes, prefix, os.Stderr); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 // first backup filename, and then replace it with src
@@ -36,3 +37,76 @@ func backupAndReplaceFile(filename string, src io.Reader) error {
 	}
 	return nil
 }
+
+// replace files together, contents are written into temp files beside them first
+// old files are kept as .bak, if any rename fails, replaced files are restored
+func replaceFiles(contents map[string][]byte) error {
+	filenames := make([]string, 0, len(contents))
+	for filename := range contents {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	temps := make(map[string]string)
+	defer func() {
+		for _, temp := range temps {
+			_ = os.Remove(temp)
+		}
+	}()
+	for _, filename := range filenames {
+		mode := os.FileMode(0600)
+		if info, err := os.Stat(filename); err == nil {
+			mode = info.Mode()
+		}
+		tempFile, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+		if err != nil {
+			return err
+		}
+		temps[filename] = tempFile.Name()
+		_, err = tempFile.Write(contents[filename])
+		if closeErr := tempFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(tempFile.Name(), mode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var replaced []string
+	backups := make(map[string]bool)
+	restore := func() {
+		for _, filename := range replaced {
+			if backups[filename] {
+				_ = os.Rename(filename+".bak", filename)
+			} else {
+				_ = os.Remove(filename)
+			}
+		}
+	}
+	for _, filename := range filenames {
+		if err := os.Rename(filename, filename+".bak"); err == nil {
+			backups[filename] = true
+		} else if !os.IsNotExist(err) {
+			restore()
+			return err
+		}
+		if err := os.Rename(temps[filename], filename); err != nil {
+			if backups[filename] {
+				_ = os.Rename(filename+".bak", filename)
+			}
+			restore()
+			return err
+		}
+		delete(temps, filename)
+		replaced = append(replaced, filename)
+	}
+	for _, filename := range filenames {
+		if backups[filename] {
+			fmt.Println("backup name " + filename + ".bak")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceFiles(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.yaml")
+	b := filepath.Join(dir, "b.yaml")
+	_ = ioutil.WriteFile(a, []byte("old a"), 0600)
+	_ = ioutil.WriteFile(b, []byte("old b"), 0644)
+
+	ast.Nil(replaceFiles(map[string][]byte{a: []byte("new a"), b: []byte("new b")}))
+	content, _ := ioutil.ReadFile(a)
+	ast.Equal("new a", string(content))
+	content, _ = ioutil.ReadFile(b + ".bak")
+	ast.Equal("old b", string(content))
+	info, _ := os.Stat(a)
+	ast.Equal(os.FileMode(0600), info.Mode())
+
+	// no file is replaced if one of them fails
+	ast.NotNil(replaceFiles(map[string][]byte{a: []byte("newer a"), filepath.Join(dir, "missing/c.yaml"): nil}))
+	content, _ = ioutil.ReadFile(a)
+	ast.Equal("new a", string(content))
+	files, _ := ioutil.ReadDir(dir)
+	ast.Len(files, 4)
+}
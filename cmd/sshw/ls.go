@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addTagFlag(lsCmd)
+	rootCmd.AddCommand(lsCmd)
+}
+
+var lsCmd = &cobra.Command{
+	Use:     "ls",
+	Short:   "list nodes with path, address and tags",
+	Example: "sshw ls --tag 'db && !eu'",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := NewNodesLoaderConfig()
+		conf.tags, _ = cmd.Flags().GetStringArray("tag")
+		nodes, err := NewNodes(conf)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		leaves, paths := sshwctl.LeafNodes(nodes)
+		for i, node := range leaves {
+			address := node.Host
+			if address != "" && node.User != "" {
+				address = node.User + "@" + address
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", paths[i], node.Alias, address, strings.Join(node.Tags, ","))
+		}
+		_ = w.Flush()
+	},
+}
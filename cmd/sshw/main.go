@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/ljun20160606/sshw/pkg/language"
 	"github.com/ljun20160606/sshw/pkg/multiplex"
 	"github.com/ljun20160606/sshw/pkg/sshwctl"
 	"github.com/manifoldco/promptui"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -24,12 +27,21 @@ var (
 		Active:   "➤ {{ .Name | cyan  }}{{if .Alias}}({{.Alias | yellow}}){{end}} {{if .Host}}{{if .User}}{{.User | faint}}{{`@` | faint}}{{end}}{{.Host | faint}}{{end}}",
 		Inactive: "  {{.Name | faint}}{{if .Alias}}({{.Alias | faint}}){{end}} {{if .Host}}{{if .User}}{{.User | faint}}{{`@` | faint}}{{end}}{{.Host | faint}}{{end}}",
 	}
+	resolvedTemplates = &promptui.SelectTemplates{
+		Label:    "✨ {{ . | green}}",
+		Active:   "➤ {{ .Path | cyan  }}{{if .Node.Alias}}({{.Node.Alias | yellow}}){{end}} {{if .Node.Host}}{{if .Node.User}}{{.Node.User | faint}}{{`@` | faint}}{{end}}{{.Node.Host | faint}}{{end}}",
+		Inactive: "  {{.Path | faint}}{{if .Node.Alias}}({{.Node.Alias | faint}}){{end}} {{if .Node.Host}}{{if .Node.User}}{{.Node.User | faint}}{{`@` | faint}}{{end}}{{.Node.Host | faint}}{{end}}",
+	}
 	Version string
 )
 
 var (
 	rootCmd = &cobra.Command{
-		Use: "sshw",
+		Use: "sshw [alias or path]",
+		Example: `sshw
+sshw web1
+sshw prod/eu/db-1
+sshw pr/eu/db`,
 		Args: func(cmd *cobra.Command, args []string) error {
 			return nil
 		},
@@ -40,13 +52,19 @@ func init() {
 	rootCmd.Flags().BoolP("ssh", "s", false, "use local ssh config '~/.ssh/config'")
 	rootCmd.Flags().BoolP("version", "v", false, "show version")
 	rootCmd.PersistentFlags().StringP("filename", "f", "", ".sshw config. filename or url")
+	addTagFlag(rootCmd)
 
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		sshwctl.RemoteConfigUrl = rootCmd.PersistentFlags().Lookup("filename").Value.String()
+	}
 	rootCmd.Run = func(cmd *cobra.Command, args []string) {
 		if v := rootCmd.Flags().Lookup("version").Value.String(); v == "true" {
 			showVersion()
 			return
 		}
-		nodes, err := NewNodes(NewNodesLoaderConfig())
+		conf := NewNodesLoaderConfig()
+		conf.tags, _ = rootCmd.Flags().GetStringArray("tag")
+		nodes, err := NewNodes(conf)
 		if err != nil {
 			fmt.Println(err)
 			return
@@ -60,6 +78,8 @@ type NodesLoaderConfig struct {
 	useSsh bool
 	// .sshw.yaml path
 	filename string
+	// tag expressions, only nodes matching all of them are loaded
+	tags []string
 }
 
 func NewNodesLoaderConfig() *NodesLoaderConfig {
@@ -69,13 +89,13 @@ func NewNodesLoaderConfig() *NodesLoaderConfig {
 	}
 }
 
-// 1. load -f yaml
+// 1. load -f yaml, its includes and config.d
 // 2. load global yaml
 // 3. render template
 // 4. load .ssh/config. Do it last because there is not env variable in ssh config
 func NewNodes(conf *NodesLoaderConfig) ([]*sshwctl.Node, error) {
 	if conf.useSsh {
-		sshNodes, sshErr := sshwctl.LoadSshConfig()
+		sshNodes, sshErr := sshwctl.LoadSshConfigWithWarn(os.Stderr)
 		if sshErr != nil {
 			return nil, sshErr
 		}
@@ -84,22 +104,57 @@ func NewNodes(conf *NodesLoaderConfig) ([]*sshwctl.Node, error) {
 		}
 		return sshNodes, nil
 	}
-	_, nodes, err := sshwctl.LoadYamlConfig(conf.filename)
+	_, nodes, err := sshwctl.LoadYamlConfigs(conf.filename)
 	if err != nil {
 		return nil, err
 	}
 	if err := sshwctl.InitNodes(nodes); err != nil {
 		return nil, err
 	}
+	sshwctl.WarnDuplicateAliases(nodes, os.Stderr)
+	if len(conf.tags) != 0 {
+		match, err := tagMatcher(conf.tags)
+		if err != nil {
+			return nil, err
+		}
+		nodes = sshwctl.FilterNodes(nodes, match)
+	}
 	return nodes, nil
 }
 
+func addTagFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArray("tag", nil, "only nodes with tags, etc. 'db && (prod || staging) && !eu', repeated flags are all matched")
+}
+
+// node matches if tags of node match every expression
+func tagMatcher(expressions []string) (func(node *sshwctl.Node) bool, error) {
+	var asts []*language.TagExpressionGrammar
+	for _, expression := range expressions {
+		ast, err := language.ParseTagExpression(expression)
+		if err != nil {
+			return nil, errors.WithMessage(err, "tag "+expression)
+		}
+		asts = append(asts, ast)
+	}
+	return func(node *sshwctl.Node) bool {
+		for _, ast := range asts {
+			if !ast.Match(node.Tags) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
 func FindAndRun(nodes []*sshwctl.Node, args []string) {
-	// login by alias
+	// login by alias or path
 	if len(args) >= 1 {
-		var nodeAlias = args[0]
-		var node = findAlias(nodes, nodeAlias)
-		if node != nil {
+		node, err := resolveNode(nodes, args[0])
+		if _, noMatch := err.(*noMatchError); !noMatch {
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
 			if err := ExecNode(node); err != nil {
 				fmt.Println(err)
 			}
@@ -139,6 +194,7 @@ func ReadPid() (int, bool) {
 }
 
 func ExecNode(node *sshwctl.Node) error {
+	sshwctl.StartPlugins()
 	if len(node.Scps) != 0 {
 		for i := range node.Scps {
 			cp := node.Scps[i]
@@ -195,7 +251,13 @@ func ExecNode(node *sshwctl.Node) error {
 	}
 }
 
-func ExecClient(client sshwctl.Client, node *sshwctl.Node) error {
+func ExecClient(client sshwctl.Client, node *sshwctl.Node) (err error) {
+	// stop commands always run, even if pre commands or session fail
+	defer func() {
+		if postErr := client.ExecsPost(); postErr != nil && err == nil {
+			err = postErr
+		}
+	}()
 	if err := client.ExecsPre(); err != nil {
 		return err
 	}
@@ -226,34 +288,60 @@ func ExecClient(client sshwctl.Client, node *sshwctl.Node) error {
 	if len(node.Scps) != 0 && len(node.CallbackShells) == 0 {
 		return nil
 	}
-	if err := client.Shell(); err != nil {
-		return err
-	}
-	if err := client.ExecsPost(); err != nil {
-		return err
-	}
-	return nil
+	return client.Shell()
 }
 
 func main() {
+	defer sshwctl.StopPlugins()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 	}
 }
 
-func findAlias(nodes []*sshwctl.Node, nodeAlias string) *sshwctl.Node {
-	for _, node := range nodes {
-		if node.Alias == nodeAlias {
-			return node
-		}
-		if len(node.Children) > 0 {
-			alias := findAlias(node.Children, nodeAlias)
-			if alias != nil {
-				return alias
-			}
-		}
+// query matches no node, the picker is shown instead
+type noMatchError struct {
+	query string
+}
+
+func (e *noMatchError) Error() string {
+	return "no node matches " + e.query
+}
+
+// node of alias or path, see sshwctl.ResolveNodes
+// prompt to choose one if several nodes match or it only matches fuzzily
+func resolveNode(nodes []*sshwctl.Node, query string) (*sshwctl.Node, error) {
+	resolved := sshwctl.ResolveNodes(nodes, query)
+	if len(resolved) == 0 {
+		return nil, &noMatchError{query: query}
+	}
+	if len(resolved) == 1 && !resolved[0].Fuzzy {
+		return resolved[0].Node, nil
+	}
+	paths := make([]string, len(resolved))
+	for i := range resolved {
+		paths[i] = resolved[i].Path
+	}
+	ambiguous := errors.Errorf("%s matches %s", query, strings.Join(paths, ", "))
+	label := query + " matches several nodes"
+	if resolved[0].Fuzzy {
+		ambiguous = errors.Errorf("%s fuzzily matches %s, use alias or path", query, strings.Join(paths, ", "))
+		label = query + " fuzzily matches"
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, ambiguous
+	}
+	prompt := promptui.Select{
+		Label:        label,
+		Items:        resolved,
+		Templates:    resolvedTemplates,
+		Size:         20,
+		HideSelected: true,
+	}
+	index, _, err := prompt.Run()
+	if err != nil {
+		return nil, ambiguous
 	}
-	return nil
+	return resolved[index].Node, nil
 }
 
 func choose(root, parent, trees []*sshwctl.Node) *sshwctl.Node {
@@ -336,7 +424,7 @@ func deepSearchHelper(node *sshwctl.Node, scope *[]*interface{}) {
 }
 
 func searchMatch(input string, node *sshwctl.Node) bool {
-	content := fmt.Sprintf("%s %s %s", node.Name, node.User, node.Host)
+	content := fmt.Sprintf("%s %s %s %s", node.Name, node.User, node.Host, strings.Join(node.Tags, " "))
 	if strings.Contains(input, " ") {
 		for _, key := range strings.Split(input, " ") {
 			key = strings.TrimSpace(key)
@@ -1,11 +1,41 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
 )
 
 func TestReadPid(t *testing.T) {
 	pid, _ := ReadPid()
 	fmt.Println(pid)
 }
+
+func TestSearchMatch(t *testing.T) {
+	node := &sshwctl.Node{Name: "db1", User: "root", Host: "10.0.0.1", Tags: []string{"db", "prod"}}
+	if !searchMatch("prod", node) || !searchMatch("db1 prod", node) {
+		t.Error("tags should be searchable")
+	}
+	if searchMatch("eu", node) {
+		t.Error("eu should not match")
+	}
+}
+
+func TestExecClientStopAfterPreFails(t *testing.T) {
+	stdout := bytes.NewBuffer(nil)
+	node := &sshwctl.Node{
+		Name:      "a",
+		Stdout:    stdout,
+		ExecsPre:  []*sshwctl.NodeExec{{Cmd: "exit 1"}},
+		ExecsStop: []*sshwctl.NodeExec{{Cmd: "echo stopped"}},
+	}
+	if err := ExecClient(sshwctl.NewClient(node), node); err == nil {
+		t.Error("pre commands should fail")
+	}
+	if !strings.Contains(stdout.String(), "stopped") {
+		t.Error("stop commands should run, stdout:", stdout.String())
+	}
+}
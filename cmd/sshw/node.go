@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/spf13/cobra"
+)
+
+// fields of `node add` flags and prompts, in order
+var nodeAddFields = []string{"alias", "host", "user", "port", "keypath"}
+
+func init() {
+	for _, key := range nodeAddFields {
+		nodeAddCmd.Flags().String(key, "", key+" of node")
+	}
+	nodeCmd.AddCommand(nodeAddCmd)
+	nodeCmd.AddCommand(nodeSetCmd)
+	nodeCmd.AddCommand(nodeRmCmd)
+	nodeCmd.AddCommand(nodeMvCmd)
+	rootCmd.AddCommand(nodeCmd)
+}
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "add, edit and remove nodes of config, comments and order are kept",
+	Long: "add, edit and remove nodes of config, comments and order are kept.\n" +
+		"node is addressed by names separated by /, etc. prod/web",
+}
+
+var nodeAddCmd = &cobra.Command{
+	Use:   "add <path> [key=value...]",
+	Short: "add node, ask host, user, port and keypath if no field is given",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keys, fields, err := parseNodeFields(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, key := range nodeAddFields {
+			if value := cmd.Flags().Lookup(key).Value.String(); value != "" {
+				if _, has := fields[key]; !has {
+					keys = append(keys, key)
+				}
+				fields[key] = value
+			}
+		}
+		if len(keys) == 0 {
+			prompter := sshwctl.NewPrompter(&sshwctl.Node{})
+			for _, key := range nodeAddFields {
+				value, err := prompter.Prompt(key+": ", true)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				if value = strings.TrimSpace(value); value != "" {
+					keys = append(keys, key)
+					fields[key] = value
+				}
+			}
+		}
+		editConfig(func(documents *sshwctl.YamlDocuments) error {
+			return documents.AddNode(args[0], keys, fields)
+		})
+	},
+}
+
+var nodeSetCmd = &cobra.Command{
+	Use:   "set <path> key=value...",
+	Short: "set fields of node, empty value removes the field, list is separated by comma",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		keys, fields, err := parseNodeFields(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		editConfig(func(documents *sshwctl.YamlDocuments) error {
+			p := args[0]
+			for _, key := range keys {
+				if err := documents.SetNodeField(p, key, fields[key]); err != nil {
+					return err
+				}
+				// renamed
+				if key == "name" {
+					names, _ := sshwctl.SplitNodePath(p)
+					p = strings.Join(append(names[:len(names)-1], fields[key]), "/")
+				}
+			}
+			return nil
+		})
+	},
+}
+
+var nodeRmCmd = &cobra.Command{
+	Use:   "rm <path>",
+	Short: "remove node and its children",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		editConfig(func(documents *sshwctl.YamlDocuments) error {
+			return documents.RemoveNode(args[0])
+		})
+	},
+}
+
+var nodeMvCmd = &cobra.Command{
+	Use:   "mv <path> <newpath>",
+	Short: "move or rename node",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		editConfig(func(documents *sshwctl.YamlDocuments) error {
+			return documents.MoveNode(args[0], args[1])
+		})
+	},
+}
+
+// key=value in order
+func parseNodeFields(args []string) ([]string, map[string]string, error) {
+	var keys []string
+	fields := make(map[string]string)
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, nil, fmt.Errorf("invalid field %s, it should be key=value", arg)
+		}
+		if _, has := fields[kv[0]]; !has {
+			keys = append(keys, kv[0])
+		}
+		fields[kv[0]] = kv[1]
+	}
+	return keys, fields, nil
+}
+
+// edit yaml of config in place, and backup it
+func editConfig(edit func(documents *sshwctl.YamlDocuments) error) {
+	filename := rootCmd.PersistentFlags().Lookup("filename").Value.String()
+	if uri, err := url.ParseRequestURI(filename); err == nil && uri.Host != "" {
+		fmt.Println("Can not edit remote config.")
+		return
+	}
+	pathname, b, err := sshwctl.ReadConfigBytes(filename)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if pathname == "" {
+		fmt.Println("config is not found")
+		return
+	}
+	documents, err := sshwctl.ParseYamlDocuments(b)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := edit(documents); err != nil {
+		fmt.Println(err)
+		return
+	}
+	out, err := documents.Bytes()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := checkConfigBytes(out); err != nil {
+		fmt.Println("edited config can not be loaded,", err)
+		return
+	}
+	if err := backupAndReplaceFile(pathname, bytes.NewReader(out)); err != nil {
+		fmt.Println("replace config", err)
+	}
+}
+
+// config is written only if it still loads, etc. aliases of removed anchors
+func checkConfigBytes(b []byte) error {
+	if _, err := sshwctl.ParseYamlDocuments(b); err != nil {
+		return err
+	}
+	_, err := sshwctl.LoadYamlConfig0(b)
+	return err
+}
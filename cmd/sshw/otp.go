@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(otpCmd)
+}
+
+var otpCmd = &cobra.Command{
+	Use:   "otp",
+	Short: "print one-time password of node",
+	Example: `sshw otp bastion
+sshw otp prod/bastion`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		nodes, err := NewNodes(NewNodesLoaderConfig())
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		node, err := resolveNode(nodes, args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		// secret may be encrypted or from ${exec:} and ${file:}
+		if err := sshwctl.ResolveNode(node); err != nil {
+			fmt.Println(err)
+			return
+		}
+		var found bool
+		for _, keyboardInteractive := range node.KeyboardInteractions {
+			if !keyboardInteractive.GoogleAuth {
+				continue
+			}
+			found = true
+			code, err := sshwctl.OtpCode(keyboardInteractive.Answer)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(code)
+		}
+		if !found {
+			fmt.Println(args[0] + " has no google-auth in keyboard-interactions")
+		}
+	},
+}
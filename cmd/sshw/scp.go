@@ -2,8 +2,14 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
 	"github.com/ljun20160606/sshw/pkg/language"
 	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -11,19 +17,29 @@ var isLocal bool
 
 func init() {
 	scpCmd.Flags().BoolVarP(&isLocal, "local", "l", false, "do not control-master")
+	addTagFlag(scpCmd)
 	rootCmd.AddCommand(scpCmd)
 }
 
 var scpCmd = &cobra.Command{
-	Use:     "scp",
-	Short:   "like scp",
-	Example: "sshw scp file user@host:",
-	Args:    cobra.MinimumNArgs(2),
+	Use:   "scp",
+	Short: "like scp",
+	Example: `sshw scp file user@host:
+sshw scp --tag 'db && prod' file :/tmp/
+sshw scp --tag db :/var/log/syslog logs/`,
+	Args: cobra.MinimumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		srcParam := args[0]
 		tgtParam := args[1]
 		isRemote := !isLocal
 
+		if tags, _ := cmd.Flags().GetStringArray("tag"); len(tags) != 0 {
+			if err := scpTaggedNodes(tags, srcParam, tgtParam, isRemote); err != nil {
+				fmt.Println(err)
+			}
+			return
+		}
+
 		var host, user string
 		var src, tgt string
 		var isReceive bool
@@ -67,3 +83,52 @@ var scpCmd = &cobra.Command{
 		}
 	},
 }
+
+// copy between local and every node matching tags, remote path is written as `:path`
+// received files are saved in directory of node path under target, etc. logs/prod/db/syslog
+func scpTaggedNodes(tags []string, srcParam, tgtParam string, isRemote bool) error {
+	var cp sshwctl.NodeCp
+	switch {
+	case strings.HasPrefix(srcParam, ":"):
+		cp = sshwctl.NodeCp{Src: srcParam[1:], Tgt: tgtParam, IsReceive: true}
+	case strings.HasPrefix(tgtParam, ":"):
+		cp = sshwctl.NodeCp{Src: srcParam, Tgt: tgtParam[1:]}
+	default:
+		return errors.New("remote path of --tag should be :path, etc. sshw scp --tag db file :/tmp/")
+	}
+	conf := NewNodesLoaderConfig()
+	conf.tags = tags
+	nodes, err := NewNodes(conf)
+	if err != nil {
+		return err
+	}
+	leaves, paths := sshwctl.LeafNodes(nodes)
+	if len(leaves) == 0 {
+		return errors.New("no node matches")
+	}
+	var failed []string
+	for i, node := range leaves {
+		nodeCp := cp
+		if nodeCp.IsReceive {
+			dir := filepath.Join(sshwctl.AbsPath(cp.Tgt), filepath.FromSlash(paths[i]))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			nodeCp.Tgt = filepath.Join(dir, path.Base(cp.Src))
+		}
+		node.Scps = []*sshwctl.NodeCp{&nodeCp}
+		node.CallbackShells = nil
+		if node.ControlMaster == nil || !isRemote {
+			node.ControlMaster = &isRemote
+		}
+		fmt.Println(paths[i])
+		if err := ExecNode(node); err != nil {
+			fmt.Println(err)
+			failed = append(failed, paths[i])
+		}
+	}
+	if len(failed) != 0 {
+		return errors.Errorf("failed on %d of %d nodes: %s", len(failed), len(leaves), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// fields encrypted by `sshw secret encrypt`
+var secretFields = map[string]bool{
+	"password":   true,
+	"passphrase": true,
+	"answer":     true,
+}
+
+const envNewMasterPassphrase = "SSHW_NEW_MASTER_PASSPHRASE"
+
+func init() {
+	secretCmd.AddCommand(secretEncryptCmd)
+	secretCmd.AddCommand(secretRotateKeyCmd)
+	rootCmd.AddCommand(secretCmd)
+}
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "encrypt password, passphrase and answer of config",
+}
+
+var secretEncryptCmd = &cobra.Command{
+	Use:   "encrypt [value]",
+	Short: "print encrypted value, or encrypt plaintext secrets of config in place",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		box, err := masterSecretBox()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if len(args) == 1 {
+			encrypted, err := box.Encrypt(args[0])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(encrypted)
+			return
+		}
+
+		contents, count, err := rewriteSecrets(false, func(key string, value *yamlv3.Node) (bool, error) {
+			// template is resolved at runtime
+			if isEncryptedNode(value) || value.Value == "" || strings.Contains(value.Value, "${") {
+				return false, nil
+			}
+			return true, setEncrypted(box, value, value.Value)
+		})
+		if err == nil {
+			err = replaceFiles(contents)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Encrypted %d secrets\n", count)
+	},
+}
+
+var secretRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "re-encrypt secrets of config with a new master key",
+	Long: fmt.Sprintf("re-encrypt secrets of config, its includes, config.d and global config with a new master key.\n"+
+		"it fails if remote or team config has secrets, they can not be rewritten.\n"+
+		"new master secret is $%s, or a random key written into %s, old key is kept as %s.bak",
+		envNewMasterPassphrase, sshwctl.MasterKeyPath, sshwctl.MasterKeyPath),
+	Run: func(cmd *cobra.Command, args []string) {
+		oldBox, err := sshwctl.DefaultSecretBox()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		newKeyPath := sshwctl.MasterKeyPath + ".new"
+		defer os.Remove(newKeyPath)
+		var newMaster []byte
+		if passphrase := os.Getenv(envNewMasterPassphrase); passphrase != "" {
+			newMaster = []byte(passphrase)
+		} else if newMaster, err = sshwctl.GenerateMasterKey(newKeyPath); err != nil {
+			fmt.Println(err)
+			return
+		}
+		newBox, err := sshwctl.NewSecretBox(newMaster)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		// every secret is rotated or none, the new key and files are replaced together, old ones are kept as .bak
+		contents, count, err := rewriteSecrets(true, func(key string, value *yamlv3.Node) (bool, error) {
+			if !isEncryptedNode(value) {
+				return false, nil
+			}
+			plaintext, err := oldBox.Decrypt(value.Value)
+			if err != nil {
+				return false, fmt.Errorf("%s: %v", key, err)
+			}
+			return true, setEncrypted(newBox, value, plaintext)
+		})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		key, keyErr := ioutil.ReadFile(newKeyPath)
+		if keyErr == nil {
+			contents[sshwctl.MasterKeyPath] = key
+		}
+		if err := replaceFiles(contents); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if keyErr == nil {
+			fmt.Println("new master key " + sshwctl.MasterKeyPath)
+		} else {
+			fmt.Printf("set %s to the new passphrase\n", sshwctl.EnvMasterPassphrase)
+		}
+		fmt.Printf("Rotated %d secrets\n", count)
+	},
+}
+
+// box of master secret, generate master key if there is none
+func masterSecretBox() (*sshwctl.SecretBox, error) {
+	if _, err := sshwctl.ReadMasterSecret(); err != nil {
+		if _, statErr := os.Stat(sshwctl.MasterKeyPath); !os.IsNotExist(statErr) {
+			return nil, err
+		}
+		if _, err := sshwctl.GenerateMasterKey(sshwctl.MasterKeyPath); err != nil {
+			return nil, err
+		}
+		fmt.Println("generate master key " + sshwctl.MasterKeyPath)
+	}
+	return sshwctl.DefaultSecretBox()
+}
+
+func isEncryptedNode(value *yamlv3.Node) bool {
+	return value.Tag == sshwctl.SecretTag || sshwctl.IsEncrypted(value.Value)
+}
+
+// keep style of value, `!encrypted <base64>` or `enc:<base64>`
+func setEncrypted(box *sshwctl.SecretBox, value *yamlv3.Node, plaintext string) error {
+	encrypted, err := box.Encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+	if value.Tag == sshwctl.SecretTag {
+		encrypted = strings.TrimPrefix(encrypted, sshwctl.SecretPrefix)
+	} else {
+		value.Tag = ""
+	}
+	value.Value = encrypted
+	value.Style = 0
+	return nil
+}
+
+// rewrite secret fields of every file read by config, return new contents of files and count of changed fields
+// remote and team config can not be rewritten, they are skipped, or it fails if strict
+// nothing is written, contents are replaced together by replaceFiles
+func rewriteSecrets(strict bool, rewrite func(key string, value *yamlv3.Node) (bool, error)) (map[string][]byte, int, error) {
+	filename := rootCmd.PersistentFlags().Lookup("filename").Value.String()
+	files, err := sshwctl.ConfigFiles(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	outs := make(map[string][]byte)
+	count := 0
+	for _, file := range files {
+		_, b, err := sshwctl.ReadConfigBytes(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		documents, err := sshwctl.ParseYamlDocuments(b)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", file, err)
+		}
+		changed := 0
+		if err := documents.WalkScalars(func(key string, value *yamlv3.Node) error {
+			if !secretFields[key] {
+				return nil
+			}
+			ok, err := rewrite(key, value)
+			if ok {
+				changed++
+			}
+			return err
+		}); err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", file, err)
+		}
+		if changed == 0 {
+			continue
+		}
+		if isReadOnlyConfig(file) {
+			if strict {
+				return nil, 0, fmt.Errorf("%s has %d secrets, it can not be rewritten", file, changed)
+			}
+			fmt.Printf("skip %s, it can not be rewritten\n", file)
+			continue
+		}
+		if outs[file], err = documents.Bytes(); err != nil {
+			return nil, 0, err
+		}
+		count += changed
+	}
+	return outs, count, nil
+}
+
+// remote config, and team config managed by `sshw sync`
+func isReadOnlyConfig(file string) bool {
+	if uri, err := url.ParseRequestURI(file); err == nil && uri.Host != "" {
+		return true
+	}
+	return strings.HasPrefix(file, sshwctl.TeamConfigDir+string(os.PathSeparator))
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/ljun20160606/sshw/pkg/multiplex"
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
 	"github.com/spf13/cobra"
 	"os"
 	"strconv"
@@ -24,6 +25,7 @@ var serverStartCmd = &cobra.Command{
 	Use:   "start",
 	Short: "run a server for multiplexing session",
 	Run: func(cmd *cobra.Command, args []string) {
+		sshwctl.StartPlugins()
 		newServer := multiplex.NewServer()
 		newServer.Handler = multiplex.NewMasterHandler()
 		if err := newServer.ListenAndServe(); err != nil {
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	syncCmd.PersistentFlags().String("repo", "", "url or path of repository, default is sync.repo of global config")
+	syncCmd.PersistentFlags().String("branch", "", "branch of repository, default is sync.branch of global config or HEAD")
+	syncCmd.Flags().Bool("verify-commit", false, "checkout commit only if its signature is good")
+	syncCmd.AddCommand(syncStatusCmd)
+	rootCmd.AddCommand(syncCmd)
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "clone or pull team config into " + sshwctl.TeamConfigDir,
+	Long: "clone or pull team config into " + sshwctl.TeamConfigDir + ".\n" +
+		"team config is layered under personal config, personal nodes override team nodes of the same name",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := syncConfig(cmd)
+		if cmd.Flags().Lookup("verify-commit").Value.String() == "true" {
+			c.VerifyCommit = true
+		}
+		if err := sshwctl.Sync(c, os.Stdout); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("Sync finished")
+	},
+}
+
+var syncStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show drift of team config from repository and personal config",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := sshwctl.GetSyncStatus(syncConfig(cmd))
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("branch %s at %s\n", status.Branch, status.Local)
+		switch status.Remote {
+		case "":
+			fmt.Println("repository can not be reached")
+		case status.Local:
+			fmt.Println("up to date with repository")
+		default:
+			fmt.Printf("repository is at %s, run `sshw sync`\n", status.Remote)
+		}
+		for _, modified := range status.Modified {
+			fmt.Println("modified " + modified)
+		}
+
+		team, err := sshwctl.LoadTeamConfig()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		filename := rootCmd.PersistentFlags().Lookup("filename").Value.String()
+		if _, personal, err := sshwctl.LoadYamlConfig(filename); err == nil {
+			for _, p := range sshwctl.OverriddenNodes(team, personal) {
+				fmt.Println("overridden by personal config " + p)
+			}
+		}
+	},
+}
+
+// sync of global config, flags override it
+func syncConfig(cmd *cobra.Command) *sshwctl.SyncConfig {
+	c := sshwctl.GlobalSyncConfig()
+	if repo := cmd.Flags().Lookup("repo").Value.String(); repo != "" {
+		c.Repo = repo
+	}
+	if branch := cmd.Flags().Lookup("branch").Value.String(); branch != "" {
+		c.Branch = branch
+	}
+	return c
+}
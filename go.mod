@@ -5,12 +5,9 @@ go 1.13
 require (
 	github.com/alecthomas/participle v0.4.3
 	github.com/alecthomas/units v0.0.0-20190717042225-c3de453c63f4 // indirect
-	github.com/atrox/homedir v1.0.0
-	github.com/dgryski/dgoogauth v0.0.0-20190221195224-5a805980a5f3
 	github.com/dustin/go-humanize v1.0.0
 	github.com/gordonklaus/ineffassign v0.0.0-20190601041439-ed7b1b5ee0f8 // indirect
 	github.com/hashicorp/go-version v1.2.0
-	github.com/kevinburke/ssh_config v0.0.0-20190630040420-2e50c441276c
 	github.com/ljun20160606/eventbus v0.0.0-20200321135348-acd5434c3c93
 	github.com/ljun20160606/go-scp v0.0.2
 	github.com/lunixbochs/vtclean v1.0.0 // indirect
@@ -20,6 +17,7 @@ require (
 	github.com/nicksnyder/go-i18n v1.10.1 // indirect
 	github.com/pelletier/go-buffruneio v0.2.0 // indirect
 	github.com/pkg/errors v0.8.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.3
 	github.com/stretchr/testify v1.5.1
@@ -29,6 +27,7 @@ require (
 	golang.org/x/tools v0.0.0-20190716221150-e98af2309876 // indirect
 	gopkg.in/alecthomas/kingpin.v3-unstable v3.0.0-20180810215634-df19058c872c // indirect
 	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 replace github.com/manifoldco/promptui => github.com/ljun20160606/promptui v0.5.0
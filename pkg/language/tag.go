@@ -0,0 +1,91 @@
+package language
+
+import (
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/alecthomas/participle/lexer/ebnf"
+)
+
+var (
+	tagLexer = lexer.Must(ebnf.New(`
+	Tag = value { value } .
+	Operator = "&" "&" | "|" "|" | "!" | "(" | ")" | "," .
+	Whitespace = " " | "\t" .
+
+	value = "a"…"z" | "A"…"Z" | "0"…"9" | "_" | "." | "-" | "/" | ":" | "=" .
+`))
+
+	tagParser *participle.Parser
+)
+
+func init() {
+	parser, err := participle.Build(&TagExpressionGrammar{},
+		participle.Lexer(tagLexer),
+		participle.Elide("Whitespace"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	tagParser = parser
+}
+
+// tag expression, `!` is the tightest, then `&&` or `,`, then `||`
+// 1. db
+// 2. db && prod
+// 3. db,prod
+// 4. (db || cache) && !eu
+type TagExpressionGrammar struct {
+	Or []*TagAndGrammar `parser:"@@ ( \"||\" @@ )*"`
+}
+
+type TagAndGrammar struct {
+	And []*TagUnaryGrammar `parser:"@@ ( ( \"&&\" | \",\" ) @@ )*"`
+}
+
+type TagUnaryGrammar struct {
+	Not   *TagUnaryGrammar      `parser:"  \"!\" @@"`
+	Group *TagExpressionGrammar `parser:"| \"(\" @@ \")\""`
+	Tag   string                `parser:"| @Tag"`
+}
+
+func ParseTagExpression(input string) (*TagExpressionGrammar, error) {
+	ast := &TagExpressionGrammar{}
+	if err := tagParser.ParseString(input, ast); err != nil {
+		return nil, err
+	}
+	return ast, nil
+}
+
+// expression is true for tags
+func (e *TagExpressionGrammar) Match(tags []string) bool {
+	for _, and := range e.Or {
+		if and.Match(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *TagAndGrammar) Match(tags []string) bool {
+	for _, unary := range e.And {
+		if !unary.Match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *TagUnaryGrammar) Match(tags []string) bool {
+	switch {
+	case e.Not != nil:
+		return !e.Not.Match(tags)
+	case e.Group != nil:
+		return e.Group.Match(tags)
+	}
+	for _, tag := range tags {
+		if tag == e.Tag {
+			return true
+		}
+	}
+	return false
+}
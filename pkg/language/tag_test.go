@@ -0,0 +1,46 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestParseTagExpression(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		tags    []string
+		want    bool
+		wantErr bool
+	}{
+		{name: "tag", input: "db", tags: []string{"db", "prod"}, want: true},
+		{name: "missing_tag", input: "web", tags: []string{"db", "prod"}, want: false},
+		{name: "and", input: "db && prod", tags: []string{"db", "prod"}, want: true},
+		{name: "and_missing", input: "db && eu", tags: []string{"db", "prod"}, want: false},
+		{name: "comma", input: "db,prod", tags: []string{"db", "prod"}, want: true},
+		{name: "or", input: "web || db", tags: []string{"db"}, want: true},
+		{name: "not", input: "!eu", tags: []string{"db"}, want: true},
+		{name: "not_and", input: "db && !eu", tags: []string{"db", "eu"}, want: false},
+		{name: "precedence", input: "web || db && eu", tags: []string{"web"}, want: true},
+		{name: "group", input: "(web || db) && !eu", tags: []string{"db", "us"}, want: true},
+		{name: "double_not", input: "!!db", tags: []string{"db"}, want: true},
+		{name: "tag_with_symbols", input: "env=prod-1", tags: []string{"env=prod-1"}, want: true},
+		{name: "empty", input: "", wantErr: true},
+		{name: "dangling_operator", input: "db &&", wantErr: true},
+		{name: "unclosed_group", input: "(db || web", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTagExpression(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseTagExpression() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if match := got.Match(tt.tags); match != tt.want {
+				t.Errorf("Match(%v) = %v, want %v", tt.tags, match, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"github.com/ljun20160606/sshw/pkg/sshwctl"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
 	"io"
 	"net"
 	"os"
@@ -28,6 +29,8 @@ type masterClient struct {
 }
 
 func NewClient(node *sshwctl.Node) sshwctl.Client {
+	// daemon prompts through forwarded stdin
+	node.StdinTerminal = terminal.IsTerminal(int(os.Stdin.Fd()))
 	client := sshwctl.NewClient(node)
 	return &masterClient{
 		LocalClient: client,
@@ -176,14 +176,13 @@ func (m *MasterHandler) Serve(w ResponseWriter, req *Request) {
 				cancelFunc()
 			}()
 			m.Process(w, stdConn, func() error {
-				return client.Scp(ctx)
+				return sshwctl.RunConnectionHooks(node, func() error {
+					return client.Scp(ctx)
+				})
 			})
 			return
 		}
 		if strings.HasPrefix(req.Path, PathTerminal) {
-			name := node.String()
-			m.clientMap.IncrRef(name)
-			m.Metric()
 			// watch window change
 			go func() {
 				for {
@@ -198,8 +197,7 @@ func (m *MasterHandler) Serve(w ResponseWriter, req *Request) {
 					}
 				}
 			}()
-			m.Process(w, stdConn, client.Shell)
-			m.clientMap.Done(name)
+			m.Terminal(w, stdConn, node, client)
 			fmt.Println("done")
 			return
 		}
@@ -209,7 +207,7 @@ func (m *MasterHandler) Serve(w ResponseWriter, req *Request) {
 
 func (m *MasterHandler) NewClient(node *sshwctl.Node) (sshwctl.Client, error) {
 	name := node.String()
-	newClient := sshwctl.NewClient(node)
+	newClient := sshwctl.NewPooledClient(node)
 	if !newClient.CanConnect() {
 		return nil, errors.New("server: should run local")
 	}
@@ -231,6 +229,21 @@ func (m *MasterHandler) NewClient(node *sshwctl.Node) (sshwctl.Client, error) {
 	return newClient, nil
 }
 
+// run shell of pooled client of node, on-connect and on-disconnect are run for the session
+// if session is closed by idle-timeout, the connection is closed too unless other sessions are using it
+func (m *MasterHandler) Terminal(w ResponseWriter, stdConn *StdConn, node *sshwctl.Node, client sshwctl.Client) {
+	name := node.String()
+	m.clientMap.IncrRef(name)
+	m.Metric()
+	err := m.Process(w, stdConn, func() error {
+		return sshwctl.RunConnectionHooks(node, client.Shell)
+	})
+	m.clientMap.Done(name)
+	if err == sshwctl.ErrIdleTimeout && m.clientMap.Evict(name) {
+		fmt.Printf("close idle connection %s\n", name)
+	}
+}
+
 func (m *MasterHandler) GetClient(name string) (sshwctl.Client, bool) {
 	load, b := m.clientMap.Load(name)
 	if b {
@@ -246,19 +259,21 @@ func (m *MasterHandler) PutClient(name string, client sshwctl.Client) {
 	})
 }
 
-func (m *MasterHandler) Process(w ResponseWriter, stdConn *StdConn, callables ...func() error) {
+// return error of the first failed callable
+func (m *MasterHandler) Process(w ResponseWriter, stdConn *StdConn, callables ...func() error) error {
 	for i := range callables {
 		f := callables[i]
 		if err := f(); err != nil {
 			m.Fail(w, err)
 			m.CloseConn(w)
 			m.CloseStd(stdConn)
-			return
+			return err
 		}
 	}
 	m.Success(w, "ok")
 	m.CloseConn(w)
 	m.CloseStd(stdConn)
+	return nil
 }
 
 // close sshwctl std connIn
@@ -341,6 +356,21 @@ func (t *TimerMap) Delete(key string) {
 	t.Kv.Delete(key)
 }
 
+// delete entry and run its callback now if nobody refers it
+func (t *TimerMap) Evict(key string) bool {
+	load, ok := t.Kv.Load(key)
+	if !ok {
+		return false
+	}
+	timerEntry := load.(*TimerEntry)
+	if !timerEntry.ZeroRef() {
+		return false
+	}
+	t.Kv.Delete(key)
+	timerEntry.Callback(timerEntry.Key, timerEntry.Value)
+	return true
+}
+
 func (t *TimerMap) Size() int {
 	var length int
 	t.Kv.Range(func(key, value interface{}) bool {
@@ -368,7 +398,7 @@ func (t *TimerMap) Daemon() {
 		})
 		for i := range expiredEntry {
 			timerEntry := expiredEntry[i]
-			t.Kv.Delete(timerEntry)
+			t.Kv.Delete(timerEntry.Key)
 			timerEntry.Callback(timerEntry.Key, timerEntry.Value)
 		}
 	}
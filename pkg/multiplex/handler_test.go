@@ -0,0 +1,126 @@
+package multiplex
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ljun20160606/sshw/pkg/sshwctl"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// client of daemon, shell returns err
+type fakeClient struct {
+	err    error
+	closed int
+}
+
+func (f *fakeClient) ExecsPre() error                                       { return nil }
+func (f *fakeClient) CanConnect() bool                                      { return true }
+func (f *fakeClient) InitTerminal() error                                   { return nil }
+func (f *fakeClient) RecoverTerminal()                                      {}
+func (f *fakeClient) ExecsPost() error                                      { return nil }
+func (f *fakeClient) WatchWindowChange(windowChange func(ch, cw int) error) {}
+func (f *fakeClient) Connect() error                                        { return nil }
+func (f *fakeClient) Scp(ctx context.Context) error                         { return nil }
+func (f *fakeClient) Shell() error                                          { return f.err }
+func (f *fakeClient) GetClient() *ssh.Client                                { return nil }
+func (f *fakeClient) SetClient(client *ssh.Client)                          {}
+func (f *fakeClient) Ping() error                                           { return nil }
+
+func (f *fakeClient) Close() error {
+	f.closed++
+	return nil
+}
+
+type fakeResponseWriter struct {
+	conn net.Conn
+}
+
+func (f *fakeResponseWriter) Write(resp *Response) error { return nil }
+
+func (f *fakeResponseWriter) Conn() net.Conn { return f.conn }
+
+func newFakeResponseWriter() *fakeResponseWriter {
+	conn, _ := net.Pipe()
+	return &fakeResponseWriter{conn: conn}
+}
+
+func TestMasterHandler_TerminalIdleTimeout(t *testing.T) {
+	ast := assert.New(t)
+	m := &MasterHandler{clientMap: &TimerMap{Interval: time.Second, Timeout: time.Minute}}
+	a := &sshwctl.Node{Host: "a", User: "root"}
+	b := &sshwctl.Node{Host: "b", User: "root"}
+
+	// session ends normally, connection is pooled
+	pooled := &fakeClient{}
+	m.PutClient(a.String(), pooled)
+	m.Terminal(newFakeResponseWriter(), &StdConn{}, a, pooled)
+	_, ok := m.GetClient(a.String())
+	ast.True(ok)
+	ast.Equal(0, pooled.closed)
+
+	// idle session closes pooled connection
+	pooled.err = sshwctl.ErrIdleTimeout
+	m.Terminal(newFakeResponseWriter(), &StdConn{}, a, pooled)
+	_, ok = m.GetClient(a.String())
+	ast.False(ok)
+	ast.Equal(1, pooled.closed)
+
+	// connection is kept for other sessions
+	shared := &fakeClient{}
+	m.PutClient(b.String(), shared)
+	m.clientMap.IncrRef(b.String())
+	m.Terminal(newFakeResponseWriter(), &StdConn{}, b, &fakeClient{err: sshwctl.ErrIdleTimeout})
+	_, ok = m.GetClient(b.String())
+	ast.True(ok)
+	ast.Equal(0, shared.closed)
+}
+
+func TestMasterHandler_TerminalHooks(t *testing.T) {
+	ast := assert.New(t)
+	m := &MasterHandler{clientMap: &TimerMap{Interval: time.Second, Timeout: time.Minute}}
+	stdout := bytes.NewBuffer(nil)
+	node := &sshwctl.Node{
+		Host:         "a",
+		User:         "root",
+		Stdout:       stdout,
+		OnConnect:    []*sshwctl.NodeExec{{Cmd: "echo $SSHW_EVENT"}},
+		OnDisconnect: []*sshwctl.NodeExec{{Cmd: "echo $SSHW_EVENT $SSHW_DURATION"}},
+	}
+	pooled := &fakeClient{}
+	m.PutClient(node.String(), pooled)
+
+	// every session of pooled connection runs hooks, before its stdout is closed
+	m.Terminal(newFakeResponseWriter(), &StdConn{}, node, pooled)
+	m.Terminal(newFakeResponseWriter(), &StdConn{}, node, &fakeClient{})
+	session := "echo $SSHW_EVENT\non-connect\necho $SSHW_EVENT $SSHW_DURATION\non-disconnect 0\n"
+	ast.Equal(session+session, stdout.String())
+
+	// dialing and closing pooled connection run no hooks
+	stdout.Reset()
+	ctx := sshwctl.NewEventContext(node)
+	ctx.Put(sshwctl.KeyPooled, true)
+	sshwctl.HookPostSSHDial(ctx, nil)
+	sshwctl.HookPostClose(ctx, time.Minute)
+	ast.Equal("", stdout.String())
+}
+
+func TestTimerMap_Daemon(t *testing.T) {
+	ast := assert.New(t)
+	timerMap := &TimerMap{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}
+	called := make(chan string, 10)
+	timerMap.Insert("a", 1, func(key string, value interface{}) {
+		called <- key
+	})
+	go timerMap.Daemon()
+
+	ast.Equal("a", <-called)
+	time.Sleep(50 * time.Millisecond)
+	// expired entry is deleted, callback runs once
+	ast.Equal(0, timerMap.Size())
+	ast.Len(called, 0)
+}
@@ -14,6 +14,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -72,10 +73,32 @@ func (c *localClient) Ping() error {
 	return err
 }
 
+// server replies keepalive in timeout
+func (c *localClient) serverAlive(timeout time.Duration) bool {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+		reply <- err
+	}()
+	select {
+	case err := <-reply:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func NewClient(node *Node) Client {
 	return newClient(node)
 }
 
+// client of daemon, its connection is shared by sessions, hooks of connection are run by RunConnectionHooks
+func NewPooledClient(node *Node) Client {
+	c := newClient(node)
+	c.eventContext.Put(KeyPooled, true)
+	return c
+}
+
 type localClient struct {
 	clientConfig *ssh.ClientConfig
 	node         *Node
@@ -84,6 +107,9 @@ type localClient struct {
 	eventContext *EventContext
 	ctx          context.Context
 	cancelFunc   context.CancelFunc
+	connectedAt  time.Time
+	// fields of node can not be resolved, it is returned by Dial
+	resolveErr error
 }
 
 func (c *localClient) CanConnect() bool {
@@ -101,11 +127,13 @@ func (c *localClient) SetClient(client *ssh.Client) {
 func newClient(node *Node) *localClient {
 	config := &ssh.ClientConfig{
 		User:            node.user(),
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: HostKeyCallback(node),
 		Timeout:         time.Second * 10,
 	}
 
 	eventContext := NewEventContext(node)
+	// auth methods read secrets of node
+	resolveErr := ResolveNode(node)
 
 	if err := bus.Publish(PostInitClientConfig, eventContext, config); err != nil {
 		node.Error(err)
@@ -118,42 +146,55 @@ func newClient(node *Node) *localClient {
 		clientConfig: config,
 		eventContext: eventContext,
 		node:         node,
+		resolveErr:   resolveErr,
 	}
 }
 
+// jump nodes are dialed in order, each one through the former
 func (c *localClient) Dial() (*ssh.Client, error) {
-	jumpNodes := c.node.Jump
-
-	if len(jumpNodes) > 0 {
-		jumpNode := jumpNodes[0]
+	if c.resolveErr != nil {
+		return nil, c.resolveErr
+	}
+	var jumper *ssh.Client
+	for _, jumpNode := range c.node.Jump {
 		jumpClient := newClient(jumpNode)
-		jumper, err := jumpClient.dial()
+		if jumpClient.resolveErr != nil {
+			return nil, errors.WithMessage(jumpClient.resolveErr, "jumpNode: "+jumpNode.addr())
+		}
+		var err error
+		if jumper == nil {
+			jumper, err = jumpClient.dial()
+		} else {
+			jumper, err = jumpClient.dialByChannel(jumper)
+		}
+		// credentials of jump node are stored or erased by its helper, other listeners are for target node only
 		if err != nil {
+			if IsAuthFailure(err) {
+				CredentialOnAuthFailure(jumpClient.eventContext, err)
+			}
 			return nil, errors.Wrap(err, "jumpNode: "+jumpNode.addr())
 		}
-
+		CredentialPostSSHDial(jumpClient.eventContext, jumper)
+	}
+	if jumper != nil {
 		return c.dialByChannel(jumper)
 	}
 	return c.dial()
 }
 
 func (c *localClient) dial() (*ssh.Client, error) {
-	client, err := ssh.Dial("tcp", c.node.addr(), c.clientConfig)
+	client, err := c.dialSSH()
 	if err != nil {
 		msg := err.Error()
 		// use terminal password retry
 		if strings.Contains(msg, "no supported methods remain") && !strings.Contains(msg, "password") {
-			c.node.Print(fmt.Sprintf("%s@%s's password:", c.clientConfig.User, c.node.Host))
-			var b []byte
-			// todo fd
-			b, err = terminal.ReadPassword(0)
+			var p string
+			p, err = NewPrompter(c.node).Prompt(fmt.Sprintf("%s@%s's password:", c.clientConfig.User, c.node.Host), false)
 			if err == nil {
-				p := string(b)
 				if p != "" {
 					c.clientConfig.Auth = append(c.clientConfig.Auth, ssh.Password(p))
 				}
-				c.node.Println("")
-				client, err = ssh.Dial("tcp", c.node.addr(), c.clientConfig)
+				return c.dialSSH()
 			}
 		}
 		return nil, err
@@ -161,6 +202,24 @@ func (c *localClient) dial() (*ssh.Client, error) {
 	return client, nil
 }
 
+// dial by tcp, or by stdin and stdout of ProxyCommand
+func (c *localClient) dialSSH() (*ssh.Client, error) {
+	if c.node.ProxyCommand == "" {
+		return ssh.Dial("tcp", c.node.addr(), c.clientConfig)
+	}
+	conn, err := DialProxyCommand(c.node)
+	if err != nil {
+		return nil, err
+	}
+	addr := c.node.addr()
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, c.clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
 func (c *localClient) dialByChannel(client *ssh.Client) (*ssh.Client, error) {
 	addr := c.node.addr()
 	conn, err := client.Dial("tcp", addr)
@@ -176,9 +235,12 @@ func (c *localClient) dialByChannel(client *ssh.Client) (*ssh.Client, error) {
 }
 
 func (c *localClient) ExecsPre() error {
-	if hasVar, err := execs(c.node.ExecsPre, c.node.stdin(), c.node.stdout()); err != nil {
+	if vars, err := execs(c.node.ExecsPre, c.node.stdin(), c.node.stdout(), hookEnv(c.node, "execs-pre")...); err != nil {
 		return err
-	} else if hasVar {
+	} else if len(vars) != 0 {
+		for k, v := range vars {
+			c.node.SetVar(k, v)
+		}
 		if err := InitConfig(c.node); err != nil {
 			return err
 		}
@@ -189,10 +251,16 @@ func (c *localClient) ExecsPre() error {
 func (c *localClient) Connect() error {
 	client, err := c.Dial()
 	if err != nil {
+		if IsAuthFailure(err) {
+			if err := bus.Publish(OnAuthFailure, c.eventContext, err); err != nil {
+				c.node.Error(err)
+			}
+		}
 		return err
 	}
 
 	c.client = client
+	c.connectedAt = time.Now()
 
 	c.node.Println(fmt.Sprintf("connect server ssh -p %d %s@%s version: %s\n", c.node.port(), c.node.user(), c.node.Host, string(client.ServerVersion())))
 
@@ -204,15 +272,33 @@ func (c *localClient) Connect() error {
 
 	// send keepalive
 	go func() {
+		interval, failures := time.Second*5, 0
+		if c.node.ServerAliveInterval > 0 {
+			interval = c.node.ServerAliveInterval
+		}
 		for {
-			time.Sleep(time.Second * 5)
+			time.Sleep(interval)
 			select {
 			case <-c.ctx.Done():
 				return
 			default:
-				if err := c.Ping(); err != nil && strings.Contains(err.Error(), "use of closed network") {
-					return
+				if c.node.ServerAliveInterval <= 0 {
+					if err := c.Ping(); err != nil && strings.Contains(err.Error(), "use of closed network") {
+						return
+					}
+					continue
+				}
+				// like ServerAliveInterval of ssh, wait reply
+				if !c.serverAlive(interval) {
+					failures++
+					if failures >= c.node.serverAliveCountMax() {
+						c.node.Println("server alive timeout")
+						_ = c.client.Close()
+						return
+					}
+					continue
 				}
+				failures = 0
 			}
 		}
 	}()
@@ -330,15 +416,20 @@ func (c *localClient) Shell() error {
 	l := NewCallbackInfo()
 	c.eventContext.Put(KeyCallback, l)
 
+	var idle *IdleWatcher
+	if timeout := c.node.idleTimeout(); timeout > 0 {
+		idle = NewIdleWatcher(timeout)
+	}
+
 	// stdout
-	if err := readLine(c.node, session, session.StdoutPipe, func(line []byte) error {
+	if err := readLine(c.node, session, idle.watchReader(session.StdoutPipe), func(line []byte) error {
 		return bus.Publish(OnStdout, c.eventContext, line)
 	}); err != nil {
 		return errors.Wrap(err, "stdout")
 	}
 
 	// stderr
-	if err := readLine(c.node, session, session.StderrPipe, func(line []byte) error {
+	if err := readLine(c.node, session, idle.watchReader(session.StderrPipe), func(line []byte) error {
 		return bus.Publish(OnStderr, c.eventContext, line)
 	}); err != nil {
 		return errors.Wrap(err, "stderr")
@@ -355,19 +446,43 @@ func (c *localClient) Shell() error {
 
 	// change stdin to user
 	go func() {
-		if _, err := io.Copy(stdinPipe, c.node.stdin()); err != nil && err != io.EOF {
+		stdin, _ := idle.watchReader(func() (io.Reader, error) {
+			return c.node.stdin(), nil
+		})()
+		if _, err := io.Copy(stdinPipe, stdin); err != nil && err != io.EOF {
 			c.node.Error(errors.WithMessage(err, "read from stdin"))
 		}
 	}()
 
-	if err := session.Wait(); err != nil {
-		return errors.WithMessage(err, "session wait")
+	start := time.Now()
+	var expired int32
+	if idle != nil {
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		defer cancelFunc()
+		go idle.Watch(ctx, func(remain time.Duration) {
+			c.node.Print(fmt.Sprintf("\r\nsshw: session is idle, it will be closed in %s\r\n", remain.Round(time.Second)))
+		}, func() {
+			c.node.Print(fmt.Sprintf("\r\nsshw: session is idle for %s, closing\r\n", idle.Timeout))
+			atomic.StoreInt32(&expired, 1)
+			_ = session.Close()
+		})
+	}
+
+	waitErr := session.Wait()
+	if err := bus.Publish(PostSessionEnd, c.eventContext, NewSessionEnd(start, waitErr)); err != nil {
+		c.node.Error(err)
+	}
+	if waitErr != nil {
+		if atomic.LoadInt32(&expired) == 1 {
+			return ErrIdleTimeout
+		}
+		return errors.WithMessage(waitErr, "session wait")
 	}
 	return nil
 }
 
 func (c *localClient) ExecsPost() error {
-	if _, err := execs(c.node.ExecsStop, c.node.stdin(), c.node.stdout()); err != nil {
+	if _, err := execs(c.node.ExecsStop, c.node.stdin(), c.node.stdout(), hookEnv(c.node, "execs-stop")...); err != nil {
 		return err
 	}
 	return nil
@@ -470,7 +585,13 @@ func (c *localClient) Close() error {
 	if c.cancelFunc != nil {
 		c.cancelFunc()
 	}
-	return c.client.Close()
+	err := c.client.Close()
+	if !c.connectedAt.IsZero() {
+		if err := bus.Publish(PostClose, c.eventContext, time.Since(c.connectedAt)); err != nil {
+			c.node.Error(err)
+		}
+	}
+	return err
 }
 
 var (
@@ -516,38 +637,82 @@ func Shell() string {
 	return currentShell
 }
 
-// execute command
-// set output into env, key is var
-// if has var return true
-func execs(execs []*NodeExec, stdin io.Reader, stdout io.Writer) (bool, error) {
-	var hasVar bool
-	currentShell := Shell()
+// command of shell, run it by runShellCommand
+// without stdin, it is in its own process group, so its children are killed with it
+// with stdin, it stays in the foreground process group, it may read terminal and get Ctrl-C
+func shellCommand(command string, stdin io.Reader) *exec.Cmd {
+	cmd := exec.Command(Shell(), "-c", command)
+	cmd.Stdin = stdin
+	if stdin == nil {
+		setProcessGroup(cmd)
+	}
+	return cmd
+}
+
+// run cmd, it is killed when ctx is done
+func runShellCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killCommand(cmd)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	return err
+}
+
+// execute command, env is appended to environment of command
+// return output of commands that have var, key is var
+// var is also env of next commands, it never changes env of process
+func execs(execs []*NodeExec, stdin io.Reader, stdout io.Writer, env ...string) (map[string]string, error) {
+	var vars map[string]string
 	for i := range execs {
 		nodeExec := execs[i]
 		cmdStr := nodeExec.Cmd
-		command := exec.Command(currentShell, "-c", cmdStr)
+		ctx, cancelFunc := context.Background(), context.CancelFunc(func() {})
+		if nodeExec.Timeout > 0 {
+			ctx, cancelFunc = context.WithTimeout(ctx, nodeExec.Timeout)
+		}
+		command := shellCommand(cmdStr, stdin)
+		if len(env) != 0 || len(vars) != 0 {
+			command.Env = append(os.Environ(), env...)
+			// var of previous command
+			for k, v := range vars {
+				command.Env = append(command.Env, k+"="+v)
+			}
+		}
 		var buffer *bytes.Buffer
 		if nodeExec.Var == "" {
 			command.Stdout = stdout
 		} else {
-			hasVar = true
 			buffer = bytes.NewBuffer(nil)
 			command.Stdout = io.MultiWriter(stdout, buffer)
 		}
 		command.Stderr = stdout
-		command.Stdin = stdin
 		_, _ = io.WriteString(stdout, cmdStr+"\n")
-		if err := command.Run(); err != nil {
-			return hasVar, err
+		err := runShellCommand(ctx, command)
+		cancelFunc()
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, errors.Errorf("%s: timeout after %s", cmdStr, nodeExec.Timeout)
+			}
+			return nil, err
 		}
 		if buffer != nil {
 			// output always contains '\n'
 			echo := buffer.String()
 			trimEcho := strings.TrimRight(echo, "\n")
-			if err := os.Setenv(nodeExec.Var, trimEcho); err != nil {
-				return hasVar, err
+			if vars == nil {
+				vars = make(map[string]string)
 			}
+			vars[nodeExec.Var] = trimEcho
 		}
 	}
-	return hasVar, nil
+	return vars, nil
 }
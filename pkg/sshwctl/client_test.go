@@ -1,9 +1,12 @@
 package sshwctl
 
 import (
+	"bytes"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 func Test_execs(t *testing.T) {
@@ -50,13 +53,18 @@ func Test_execsVar(t *testing.T) {
 			Cmd: "echo 1",
 			Var: envName,
 		},
+		{
+			Cmd: "echo $sshw_number$sshw_number",
+			Var: "sshw_double",
+		},
 	}
 
-	_, err := execs(nodes, os.Stdin, os.Stdout)
+	vars, err := execs(nodes, os.Stdin, os.Stdout)
 	ast.Nil(err)
+	ast.Equal(map[string]string{envName: "1", "sshw_double": "11"}, vars)
 
-	envValue := os.Getenv(envName)
-	ast.Equal("1", envValue)
+	// process env is untouched
+	ast.Equal("", os.Getenv(envName))
 }
 
 func Test_parseFileName(t *testing.T) {
@@ -107,3 +115,32 @@ func Test_parseFileName(t *testing.T) {
 		})
 	}
 }
+
+func Test_execsEnvAndTimeout(t *testing.T) {
+	ast := assert.New(t)
+
+	out := bytes.NewBuffer(nil)
+	_, err := execs([]*NodeExec{{Cmd: "echo $SSHW_NODE_NAME $SSHW_DURATION"}}, nil, out, hookEnv(&Node{Name: "foo"}, "on-disconnect", durationEnv(time.Minute))...)
+	ast.Nil(err)
+	ast.Equal("echo $SSHW_NODE_NAME $SSHW_DURATION\nfoo 60\n", out.String())
+
+	_, err = execs([]*NodeExec{{Cmd: "sleep 1", Timeout: 50 * time.Millisecond}}, nil, out)
+	ast.NotNil(err)
+
+	// children of shell keep stdout open until they are killed
+	start := time.Now()
+	_, err = execs([]*NodeExec{{Cmd: "sleep 5 | cat", Timeout: 50 * time.Millisecond}}, nil, out)
+	ast.NotNil(err)
+	ast.True(time.Since(start) < 2*time.Second)
+}
+
+func TestNewSessionEnd(t *testing.T) {
+	ast := assert.New(t)
+
+	sessionEnd := NewSessionEnd(time.Now().Add(-time.Second), nil)
+	ast.Equal(0, sessionEnd.ExitStatus)
+	ast.True(sessionEnd.Duration >= time.Second)
+
+	sessionEnd = NewSessionEnd(time.Now(), errors.New("closed"))
+	ast.Equal(255, sessionEnd.ExitStatus)
+}
@@ -0,0 +1,83 @@
+package sshwctl
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// run command on node without terminal, like `ssh host command`
+// execs-pre and execs-stop of node are run around it
+func RunCommand(node *Node, command string, stdout, stderr io.Writer) (err error) {
+	client := NewClient(node)
+	if err := client.ExecsPre(); err != nil {
+		return err
+	}
+	defer func() {
+		if postErr := client.ExecsPost(); postErr != nil && err == nil {
+			err = postErr
+		}
+	}()
+	if !client.CanConnect() {
+		return errors.New("node has no host")
+	}
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	session, err := client.GetClient().NewSession()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(command)
+}
+
+// writer prefixes every line, lines of concurrent writers are not mixed
+// call Flush to write the last line without newline
+type PrefixWriter struct {
+	W      io.Writer
+	Prefix string
+	Lock   sync.Locker
+	buf    []byte
+}
+
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+func (w *PrefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := append(w.buf, '\n')
+	w.buf = nil
+	return w.writeLine(line)
+}
+
+func (w *PrefixWriter) writeLine(line []byte) error {
+	if w.Lock != nil {
+		w.Lock.Lock()
+		defer w.Lock.Unlock()
+	}
+	_, err := w.W.Write(append([]byte(w.Prefix), line...))
+	return err
+}
@@ -0,0 +1,25 @@
+package sshwctl
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	ast := assert.New(t)
+	out := bytes.NewBuffer(nil)
+	w := &PrefixWriter{W: out, Prefix: "db: ", Lock: new(sync.Mutex)}
+	n, err := w.Write([]byte("a\nb"))
+	ast.Nil(err)
+	ast.Equal(3, n)
+	ast.Equal("db: a\n", out.String())
+	_, _ = w.Write([]byte("c\n\n"))
+	ast.Equal("db: a\ndb: bc\ndb: \n", out.String())
+	_, _ = w.Write([]byte("d"))
+	ast.Nil(w.Flush())
+	ast.Nil(w.Flush())
+	ast.Equal("db: a\ndb: bc\ndb: \ndb: d\n", out.String())
+}
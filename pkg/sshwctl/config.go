@@ -2,23 +2,20 @@ package sshwctl
 
 import (
 	"bytes"
-	"fmt"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh/terminal"
 	"io"
 	"io/ioutil"
 	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"sync"
 	"time"
 
-	"github.com/atrox/homedir"
-	"github.com/kevinburke/ssh_config"
 	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v2"
 )
@@ -49,6 +46,51 @@ type Node struct {
 	MergeIgnore          bool                  `yaml:"merge-ignore,omitempty"`
 	KeyboardInteractions []KeyboardInteractive `yaml:"keyboard-interactions"`
 	ControlMaster        *bool                 `yaml:"control-master"`
+	// close session if there is no traffic, etc. 15m
+	IdleTimeout time.Duration `yaml:"idle-timeout,omitempty"`
+	// command to ask password if stdin is not a terminal, default is $SSH_ASKPASS
+	Askpass string `yaml:"askpass,omitempty"`
+	// never prompt, auth fails if it needs input
+	BatchMode bool `yaml:"batch-mode,omitempty"`
+	// command to get password, passphrase and answers, see credential.go
+	CredentialHelper string `yaml:"credential-helper,omitempty"`
+	// hooks, see listener_hook.go
+	OnConnect     []*NodeExec `yaml:"on-connect,omitempty"`
+	OnDisconnect  []*NodeExec `yaml:"on-disconnect,omitempty"`
+	OnAuthFailure []*NodeExec `yaml:"on-auth-failure,omitempty"`
+	OnSessionEnd  []*NodeExec `yaml:"on-session-end,omitempty"`
+	// variables of node and its children, read by template before env, etc. ${db_pass}
+	// `var` of execs-pre is written here, see SetVar
+	Vars map[string]string `yaml:"vars,omitempty"`
+	// files, globs or urls of children, see include.go
+	Include []string `yaml:"include,omitempty"`
+	// default fields of descendants, etc. user, port, keypath, jump, keyboard-interactions, vars
+	Defaults *Node `yaml:"defaults,omitempty"`
+	// tags of node, inherited by children, matched by match-tags of global config, see InheritTags
+	Tags []string `yaml:"tags,omitempty"`
+	// node is expanded into nodes at load time, etc. `range: 01-12`, `for-each: [a, b]`, see expand.go
+	Range   string   `yaml:"range,omitempty"`
+	ForEach []string `yaml:"for-each,omitempty"`
+	// only global config, match nodes by ssh style patterns, cidr and tags, see match.go
+	// etc. `host-pattern: "*.prod.example.com,!db.prod.example.com"`, `cidr: 10.20.0.0/16`
+	HostPattern string   `yaml:"host-pattern,omitempty"`
+	Cidr        string   `yaml:"cidr,omitempty"`
+	MatchTags   []string `yaml:"match-tags,omitempty"`
+	// command connected to ssh server by stdin and stdout, etc. `nc %h %p`
+	ProxyCommand string `yaml:"proxy-command,omitempty"`
+	// like ssh -L and -R, etc. `8080 localhost:80`, see forward.go
+	LocalForward  []string `yaml:"local-forward,omitempty"`
+	RemoteForward []string `yaml:"remote-forward,omitempty"`
+	// send keepalive and wait reply, close connection after count max of failures
+	ServerAliveInterval time.Duration `yaml:"server-alive-interval,omitempty"`
+	ServerAliveCountMax int           `yaml:"server-alive-count-max,omitempty"`
+	// yes, accept-new, ask or no(default), see hostkey.go
+	StrictHostKeyChecking string `yaml:"strict-host-key-checking,omitempty"`
+	UserKnownHostsFile    string `yaml:"user-known-hosts-file,omitempty" sshw:"path"`
+	// certificate of KeyPath
+	CertificateFile string `yaml:"certificate-file,omitempty" sshw:"path"`
+	// private keys tried after KeyPath, etc. more IdentityFile of .ssh/config
+	IdentityFiles []string `yaml:"identity-files,omitempty"`
 
 	Stdin   io.ReadCloser   `yaml:"-"`
 	Stdout  io.Writer       `yaml:"-"`
@@ -57,6 +99,19 @@ type Node struct {
 	Height  int             `yaml:"-"`
 	State   *terminal.State `yaml:"-"`
 	Session *ssh.Session    `yaml:"-"`
+	// Stdin is forwarded from a terminal in raw mode
+	StdinTerminal bool `yaml:"-"`
+	// go names of fields filled by inventory items, they are never rendered, see markVerbatim
+	Verbatim map[string]bool `yaml:"-"`
+}
+
+// v is the field of node filled by inventory item
+func (n *Node) isVerbatim(name string, v reflect.Value) bool {
+	if n == nil || !n.Verbatim[name] || !v.CanAddr() {
+		return false
+	}
+	field := reflect.ValueOf(n).Elem().FieldByName(name)
+	return field.IsValid() && field.Addr().Pointer() == v.Addr().Pointer()
 }
 
 func (n *Node) stdin() io.ReadCloser {
@@ -96,19 +151,30 @@ func (n *Node) Error(err error) {
 // sshw will answer question if question contains content that we set.
 // if AnswerAll is true, it will don't match question
 type KeyboardInteractive struct {
-	Question   string
-	Answer     string
+	Question string
+	Answer   string
+	// Answer is base32 secret or otpauth uri, answer one-time password, see otp.go
 	GoogleAuth bool `yaml:"google-auth"`
 }
 
 // merge srcNode to dstNode
 // only compare name and override, otherwise it is complex.
 func MergeNodes(dstPtr *[]*Node, src []*Node) {
+	mergeNodes(dstPtr, src, true)
+}
+
+// layer src over dst like MergeNodes, but nodes of src with merge-ignore are kept
+// etc. personal config over team config, includes and config.d
+func LayerNodes(dstPtr *[]*Node, src []*Node) {
+	mergeNodes(dstPtr, src, false)
+}
+
+func mergeNodes(dstPtr *[]*Node, src []*Node, skipIgnored bool) {
 	dst := *dstPtr
 	var canMerged []*Node
 	for srcIndex := range src {
 		srcNode := src[srcIndex]
-		if srcNode.MergeIgnore {
+		if skipIgnored && srcNode.MergeIgnore {
 			continue
 		}
 		nodeIndex := -1
@@ -125,7 +191,7 @@ func MergeNodes(dstPtr *[]*Node, src []*Node) {
 		}
 		dstNode := dst[nodeIndex]
 		if IsBookmark(dstNode) && IsBookmark(srcNode) {
-			MergeNodes(&dstNode.Children, srcNode.Children)
+			mergeNodes(&dstNode.Children, srcNode.Children, skipIgnored)
 		} else {
 			dst[nodeIndex] = srcNode
 		}
@@ -140,13 +206,15 @@ func MergeNodes(dstPtr *[]*Node, src []*Node) {
 //    - name: bar
 //    - name: zoo
 func IsBookmark(n *Node) bool {
-	notEmptyNames, _ := FieldsNotEmpty(n, []string{"Name", "Children", "MergeIgnore"})
+	notEmptyNames, _ := FieldsNotEmpty(n, []string{"Name", "Children", "MergeIgnore", "Vars", "Include", "Defaults", "Tags"})
 	return len(notEmptyNames) == 0
 }
 
 type NodeExec struct {
 	Cmd string `yaml:"cmd"`
 	Var string `yaml:"var"`
+	// kill command if it runs too long, 0 means never
+	Timeout time.Duration `yaml:"timeout,omitempty"`
 }
 
 type NodeCallbackShell struct {
@@ -205,10 +273,121 @@ func (n *Node) alias() string {
 	return n.Alias
 }
 
+func (n *Node) askpass() string {
+	if n.Askpass != "" {
+		return n.Askpass
+	}
+	return os.Getenv("SSH_ASKPASS")
+}
+
+// vars of all nodes share one lock, nodes are used by concurrent sessions of daemon
+var varsLock sync.RWMutex
+
+func (n *Node) Var(name string) (string, bool) {
+	varsLock.RLock()
+	defer varsLock.RUnlock()
+	v, has := n.Vars[name]
+	return v, has
+}
+
+func (n *Node) SetVar(name, value string) {
+	varsLock.Lock()
+	defer varsLock.Unlock()
+	if n.Vars == nil {
+		n.Vars = make(map[string]string)
+	}
+	n.Vars[name] = value
+}
+
+// copy vars of parent into children, child overrides parent
+func InheritVars(nodes []*Node, vars map[string]string) {
+	for _, node := range nodes {
+		for k, v := range vars {
+			if _, has := node.Var(k); !has {
+				node.SetVar(k, v)
+			}
+		}
+		varsLock.RLock()
+		childVars := make(map[string]string, len(node.Vars))
+		for k, v := range node.Vars {
+			childVars[k] = v
+		}
+		varsLock.RUnlock()
+		InheritVars(node.Children, childVars)
+	}
+}
+
+// children have tags of their ancestors, etc. tags of `prod` bookmark are on every node under it
+func InheritTags(nodes []*Node, tags []string) {
+	for _, node := range nodes {
+		for _, tag := range tags {
+			if !hasTags(node, []string{tag}) {
+				node.Tags = append(node.Tags, tag)
+			}
+		}
+		InheritTags(node.Children, node.Tags)
+	}
+}
+
+// nodes matched by match, bookmarks are kept if any of descendants is matched
+// matched nodes are shared, bookmarks are copied with matched children
+func FilterNodes(nodes []*Node, match func(node *Node) bool) []*Node {
+	var filtered []*Node
+	for _, node := range nodes {
+		if len(node.Children) == 0 {
+			if match(node) {
+				filtered = append(filtered, node)
+			}
+			continue
+		}
+		if children := FilterNodes(node.Children, match); len(children) != 0 {
+			bookmark := *node
+			bookmark.Children = children
+			filtered = append(filtered, &bookmark)
+		}
+	}
+	return filtered
+}
+
+// nodes without children, name is the path of bookmarks, etc. prod/db
+func LeafNodes(nodes []*Node) ([]*Node, []string) {
+	var leaves []*Node
+	var paths []string
+	var walk func(nodes []*Node, prefix string)
+	walk = func(nodes []*Node, prefix string) {
+		for _, node := range nodes {
+			p := joinNodePath(prefix, node.Name)
+			if len(node.Children) == 0 {
+				leaves = append(leaves, node)
+				paths = append(paths, p)
+				continue
+			}
+			walk(node.Children, p)
+		}
+	}
+	walk(nodes, "")
+	return leaves, paths
+}
+
+func (n *Node) serverAliveCountMax() int {
+	if n.ServerAliveCountMax > 0 {
+		return n.ServerAliveCountMax
+	}
+	return 3
+}
+
+// use global idle-timeout if node does not set it
+func (n *Node) idleTimeout() time.Duration {
+	if n.IdleTimeout > 0 {
+		return n.IdleTimeout
+	}
+	return globalSettings.IdleTimeout
+}
+
 // match .ssh/config Pattern
 // if Node.Host == config.Host
 // set config.HostName to Node.Host
-// same set config.User and config.Port
+// fill empty fields like config.User, config.Port and config.ProxyJump
 func MergeSshConfig(nodes []*Node, sshNodes []*Node) error {
 	if nodes == nil || sshNodes == nil {
 		return nil
@@ -226,12 +405,7 @@ func MergeSshConfig(nodes []*Node, sshNodes []*Node) error {
 			// sNode.Name is Host Pattern
 			if node.Host == sNode.Name {
 				node.Host = sNode.Host
-				if node.User == "" {
-					node.User = sNode.User
-				}
-				if node.Port == 0 {
-					node.Port = sNode.Port
-				}
+				fillIfEmpty(node, sNode)
 			}
 		}
 	}
@@ -239,15 +413,80 @@ func MergeSshConfig(nodes []*Node, sshNodes []*Node) error {
 }
 
 // render template into nodes
-// 1. Parse template ${Env_Variable}
+// 1. Parse template ${Env_Variable}, ${file:xxx}, ${node:Host}..., secret enc:xxx is kept
 // 2. solve path.convert '*' to absPath
 func InitConfig(config interface{}) error {
-	if err := WalkInterface(reflect.ValueOf(config), false, func(k string, t reflect.Type, v reflect.Value, structField *reflect.StructField) (stop bool) {
+	return initConfig(config, false)
+}
+
+// lazy keeps fields using ${exec:xxx} or ${file:xxx}, they are resolved for the node to connect by ResolveNode
+func initConfig(config interface{}, lazy bool) error {
+	// nodes share cache of ${exec:xxx} in one load
+	ctx := &TemplateContext{lazy: lazy, execs: newExecCache()}
+	if node, ok := config.(*Node); ok && node != nil {
+		ctx.Node = node
+	}
+	if err := renderConfig(reflect.ValueOf(config), ctx, lazy, true); err != nil {
+		return errors.WithMessage(err, "prepare config")
+	}
+	return nil
+}
+
+// resolve fields of the node to connect, ${exec:xxx}, ${file:xxx} and secrets are kept by InitNodes
+// children and jump nodes are resolved by their own clients
+func ResolveNode(node *Node) error {
+	if err := renderConfig(reflect.ValueOf(node), NewTemplateContext(node), false, false); err != nil {
+		return errors.WithMessage(err, "node "+node.Name)
+	}
+	if err := DecryptNodeSecrets(node); err != nil {
+		return errors.WithMessage(err, "node "+node.Name)
+	}
+	return nil
+}
+
+var nodeType = reflect.TypeOf(&Node{})
+
+// every node is rendered with its own context, return first error
+// nested nodes are skipped unless nested is true
+func renderConfig(config reflect.Value, ctx *TemplateContext, lazy, nested bool) error {
+	var renderErr error
+	if err := WalkInterface(config, false, func(k string, t reflect.Type, v reflect.Value, structField *reflect.StructField) (stop bool) {
+		if renderErr != nil {
+			return true
+		}
+		if t == nodeType {
+			if node := v.Interface().(*Node); node != nil && nested {
+				nodeCtx := NewTemplateContext(node)
+				nodeCtx.lazy = lazy
+				if ctx != nil {
+					nodeCtx.execs = ctx.execs
+				}
+				if err := renderConfig(v, nodeCtx, lazy, nested); err != nil {
+					renderErr = errors.WithMessage(err, "node "+node.Name)
+				}
+			}
+			return true
+		}
+		if structField != nil && ctx != nil && ctx.Node.isVerbatim(k, v) {
+			return true
+		}
 		if t.Kind() != reflect.String || !v.CanSet() {
 			return
 		}
 
-		r := ParseSshwTemplate(v.Interface().(string)).Execute()
+		s := v.Interface().(string)
+		// secret is decrypted when node is connected, see DecryptNodeSecrets
+		if IsEncrypted(s) {
+			return
+		}
+		r, err := ParseSshwTemplate(s).ExecuteContext(ctx)
+		if err != nil {
+			if errors.Cause(err) == errLazySource {
+				return
+			}
+			renderErr = errors.WithMessage(err, k)
+			return true
+		}
 
 		if structField != nil {
 			switch tagSshw := structField.Tag.Get("sshw"); tagSshw {
@@ -258,31 +497,59 @@ func InitConfig(config interface{}) error {
 		v.Set(reflect.ValueOf(r))
 		return
 	}); err != nil {
-		return errors.WithMessage(err, "prepare config")
+		return err
 	}
-	return nil
+	return renderErr
 }
 
 // global config
-var globalConfig []*Node
+var (
+	globalConfig   []*Node
+	globalSettings = new(Settings)
+)
+
+// settings of sshw, written as a yaml document without name in global config
+// etc. `idle-timeout: 15m`
+type Settings struct {
+	// default of Node.IdleTimeout
+	IdleTimeout time.Duration `yaml:"idle-timeout,omitempty"`
+	// external executables subscribe events, see plugin.go
+	Plugins []*PluginConfig `yaml:"plugins,omitempty"`
+	// precedence of matched global entries, first(default) or specific
+	GlobalMatch string `yaml:"global-match,omitempty"`
+	// headers, ca and timeout of remote config, see remote.go
+	Remotes []*RemoteConfig `yaml:"remotes,omitempty"`
+	// git repository of team config, see sync.go
+	Sync *SyncConfig `yaml:"sync,omitempty"`
+}
 
 func init() {
-	_, globalConfig, _ = LoadYamlConfig(SshwGlobalConfigPath)
+	loadGlobalConfig()
+}
+
+// global config is a local file, it is read before remotes of its settings are known
+func loadGlobalConfig() {
+	_, b, err := ReadConfigBytes(SshwGlobalConfigPath)
+	if err != nil {
+		return
+	}
+	globalConfig, _ = LoadYamlConfig0(b)
+	_ = LoadYamlSettings(b, globalSettings)
 }
 
 type MatchFunc func(node *Node, globalNode *Node) bool
 
 func MatchCommonConfig(node *Node, globalNode *Node) bool {
-	return node.Host == globalNode.Host
+	return matchGlobalNode(node, globalNode, node.Host)
 }
 
 func MatchSshConfig(node *Node, globalNode *Node) bool {
-	return node.Host == globalNode.Host || node.Name == globalNode.Host
+	return matchGlobalNode(node, globalNode, node.Host, node.Name)
 }
 
 // update nodes based on global config
-// if host is equal, update node
-// only iterate first level
+// if host is equal or host-pattern, cidr, match-tags match, update node
+// precedence of matched entries is Settings.GlobalMatch
 func InitNodesBaseOnGlobal(nodes []*Node, matchFunc MatchFunc) {
 	if nodes == nil || globalConfig == nil {
 		return
@@ -290,12 +557,28 @@ func InitNodesBaseOnGlobal(nodes []*Node, matchFunc MatchFunc) {
 	for i := range nodes {
 		node := nodes[i]
 		InitNodesBaseOnGlobal(node.Children, matchFunc)
-		for si := range globalConfig {
-			globalNode := globalConfig[si]
-			if matchFunc(node, globalNode) {
-				fillIfEmpty(node, globalNode)
+		for _, globalNode := range matchedGlobalNodes(node, matchFunc) {
+			fillIfEmpty(node, globalNode)
+		}
+	}
+}
+
+// fill descendants with defaults of parent bookmarks, nearer defaults win
+func InitNodesBaseOnDefaults(nodes []*Node, defaults *Node) {
+	for i := range nodes {
+		node := nodes[i]
+		if defaults != nil && !IsBookmark(node) {
+			fillIfEmpty(node, defaults)
+		}
+		childDefaults := defaults
+		if node.Defaults != nil {
+			childDefaults = new(Node)
+			fillIfEmpty(childDefaults, node.Defaults)
+			if defaults != nil {
+				fillIfEmpty(childDefaults, defaults)
 			}
 		}
+		InitNodesBaseOnDefaults(node.Children, childDefaults)
 	}
 }
 
@@ -313,6 +596,9 @@ func fillIfEmpty(node, sNode *Node) {
 	if len(node.KeyboardInteractions) == 0 {
 		node.KeyboardInteractions = sNode.KeyboardInteractions
 	}
+	if len(node.Jump) == 0 {
+		node.Jump = sNode.Jump
+	}
 	if node.ControlMaster == nil {
 		node.ControlMaster = sNode.ControlMaster
 	}
@@ -322,6 +608,44 @@ func fillIfEmpty(node, sNode *Node) {
 	if node.Passphrase == "" {
 		node.Passphrase = sNode.Passphrase
 	}
+	if node.IdleTimeout == 0 {
+		node.IdleTimeout = sNode.IdleTimeout
+	}
+	if node.Askpass == "" {
+		node.Askpass = sNode.Askpass
+	}
+	if !node.BatchMode {
+		node.BatchMode = sNode.BatchMode
+	}
+	if node.CredentialHelper == "" {
+		node.CredentialHelper = sNode.CredentialHelper
+	}
+	if node.ProxyCommand == "" {
+		node.ProxyCommand = sNode.ProxyCommand
+	}
+	if node.ServerAliveInterval == 0 {
+		node.ServerAliveInterval = sNode.ServerAliveInterval
+	}
+	if node.ServerAliveCountMax == 0 {
+		node.ServerAliveCountMax = sNode.ServerAliveCountMax
+	}
+	if node.StrictHostKeyChecking == "" {
+		node.StrictHostKeyChecking = sNode.StrictHostKeyChecking
+	}
+	if node.UserKnownHostsFile == "" {
+		node.UserKnownHostsFile = sNode.UserKnownHostsFile
+	}
+	if node.CertificateFile == "" {
+		node.CertificateFile = sNode.CertificateFile
+	}
+	if len(node.IdentityFiles) == 0 {
+		node.IdentityFiles = sNode.IdentityFiles
+	}
+	for k, v := range sNode.Vars {
+		if _, has := node.Var(k); !has {
+			node.SetVar(k, v)
+		}
+	}
 }
 
 // return filepath and nodes, load config in filename
@@ -350,18 +674,11 @@ func ReadConfigBytes(filename string) (string, []byte, error) {
 	}
 	// as url, if filename is /absolute/filename, err is nil, so need check Host
 	if uri, err := url.ParseRequestURI(filename); err == nil && uri.Host != "" {
-		if response, err := http.Get(filename); err != nil {
+		b, err := FetchRemoteConfig(filename)
+		if err != nil {
 			return "", nil, err
-		} else {
-			defer func() {
-				_ = response.Body.Close()
-			}()
-			if b, err := ioutil.ReadAll(response.Body); err != nil {
-				return "", nil, err
-			} else {
-				return filename, b, nil
-			}
 		}
+		return filename, b, nil
 	}
 	// specify path
 	pathname := AbsPath(filename)
@@ -397,11 +714,16 @@ func LoadYamlConfig0(bs []byte) ([]*Node, error) {
 	if err := configLoader.Decode(&result); err != nil {
 		return nil, err
 	}
-	return result, nil
+	return ExpandNodes(result)
 }
 
 // return config of .ssh/config
 func LoadSshConfig() ([]*Node, error) {
+	return LoadSshConfigWithWarn(nil)
+}
+
+// return config of .ssh/config, unsupported options are warned into w
+func LoadSshConfigWithWarn(w io.Writer) ([]*Node, error) {
 	f, err := os.Open(SshPath)
 	var nc []*Node
 	if err != nil {
@@ -413,7 +735,7 @@ func LoadSshConfig() ([]*Node, error) {
 	defer func() {
 		_ = f.Close()
 	}()
-	loader := NewSshConfigLoader(f)
+	loader := &SshConfigLoader{r: f, Warn: w}
 	if err := loader.Decode(&nc); err != nil {
 		return nil, err
 	}
@@ -429,12 +751,16 @@ type YamlConfigLoader struct {
 }
 
 func NewYamlConfigLoader(bs []byte) ConfigLoader {
-	return &YamlConfigLoader{bs: bs}
+	return &YamlConfigLoader{bs: rewriteSecretTag(bs)}
 }
 
 func (y *YamlConfigLoader) Decode(nodes *[]*Node) error {
-	reader1 := bytes.NewReader(y.bs)
-	reader2 := bytes.NewReader(y.bs)
+	bs, err := renderTypedTemplates(y.bs, nodeType)
+	if err != nil {
+		return err
+	}
+	reader1 := bytes.NewReader(bs)
+	reader2 := bytes.NewReader(bs)
 	{
 		var e error
 		decoder1 := yaml.NewDecoder(reader1)
@@ -446,10 +772,8 @@ func (y *YamlConfigLoader) Decode(nodes *[]*Node) error {
 					return nil
 				}
 				e = err
-			} else {
-				if n.Name == "" {
-					continue
-				}
+			} else if n.Name != "" {
+				// document without name is not a node, etc. Settings
 				*nodes = append(*nodes, n)
 			}
 
@@ -468,39 +792,36 @@ func (y *YamlConfigLoader) Decode(nodes *[]*Node) error {
 	}
 }
 
-type SshConfigLoader struct {
-	r io.Reader
-}
-
-func NewSshConfigLoader(r io.Reader) ConfigLoader {
-	return &SshConfigLoader{r: r}
-}
-
-func (s *SshConfigLoader) Decode(nodes *[]*Node) error {
-	cfg, err := ssh_config.Decode(s.r)
+// decode documents that are mapping without name into settings
+func LoadYamlSettings(bs []byte, settings interface{}) error {
+	bs, err := renderTypedTemplates(rewriteSecretTag(bs), reflect.TypeOf(settings))
 	if err != nil {
 		return err
 	}
-	for _, host := range cfg.Hosts {
-		alias := fmt.Sprintf("%s", host.Patterns[0])
-		hostName, err := cfg.Get(alias, "HostName")
+	decoder := yaml.NewDecoder(bytes.NewReader(bs))
+	for {
+		var document map[string]interface{}
+		if err := decoder.Decode(&document); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			// sequence of nodes
+			if _, ok := err.(*yaml.TypeError); ok {
+				continue
+			}
+			return err
+		}
+		if _, has := document["name"]; has || len(document) == 0 {
+			continue
+		}
+		b, err := yaml.Marshal(document)
 		if err != nil {
-			return errors.WithMessage(err, "load ssh")
+			return err
 		}
-		if hostName != "" {
-			port, _ := cfg.Get(alias, "Port")
-			var c = new(Node)
-			c.Name = alias
-			c.Alias = alias
-			c.Host = hostName
-			c.User, _ = cfg.Get(alias, "User")
-			c.Port, _ = strconv.Atoi(port)
-			keyPath, _ := cfg.Get(alias, "IdentityFile")
-			c.KeyPath, _ = homedir.Expand(keyPath)
-			*nodes = append(*nodes, c)
+		if err := yaml.Unmarshal(b, settings); err != nil {
+			return errors.WithMessage(err, "load settings")
 		}
 	}
-	return nil
 }
 
 func ReadDefaultConfigBytes(names ...string) (string, []byte, error) {
@@ -523,14 +844,17 @@ func ReadDefaultConfigBytes(names ...string) (string, []byte, error) {
 	return "", nil, nil
 }
 
-// 1. load global yaml
+// 1. load defaults, tags of bookmarks and global yaml
 // 2. render template
 // 3. load .ssh/config
 func InitNodes(nodes []*Node) error {
 	// 1
+	InitNodesBaseOnDefaults(nodes, nil)
+	InheritTags(nodes, nil)
 	InitNodesBaseOnGlobal(nodes, MatchCommonConfig)
+	InheritVars(nodes, nil)
 	// 2
-	if err := InitConfig(nodes); err != nil {
+	if err := initConfig(nodes, true); err != nil {
 		return err
 	}
 	// 3
@@ -547,7 +871,7 @@ func InitSshNodes(nodes []*Node) error {
 	// 1
 	InitNodesBaseOnGlobal(nodes, MatchSshConfig)
 	// 2
-	if err := InitConfig(nodes); err != nil {
+	if err := initConfig(nodes, true); err != nil {
 		return err
 	}
 	return nil
@@ -3,11 +3,16 @@ package sshwctl
 import (
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v2"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/user"
+	"path"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestMergeNodes(t *testing.T) {
@@ -232,6 +237,30 @@ name: bar
 	ast.NotNil(err)
 }
 
+func TestLoadYamlSettings(t *testing.T) {
+	ast := assert.New(t)
+
+	bs := []byte(`
+idle-timeout: 15m
+---
+- name: foo
+  idle-timeout: 1m
+`)
+	settings := new(Settings)
+	if !ast.Nil(LoadYamlSettings(bs, settings)) {
+		return
+	}
+	ast.Equal(15*time.Minute, settings.IdleTimeout)
+
+	nodes, err := LoadYamlConfig0(bs)
+	if !ast.Nil(err) {
+		return
+	}
+	if ast.Len(nodes, 1) {
+		ast.Equal(time.Minute, nodes[0].IdleTimeout)
+	}
+}
+
 func TestReadRemoteConfig(t *testing.T) {
 	ast := assert.New(t)
 
@@ -331,3 +360,187 @@ func TestInitNodesWithSshwConfig(t *testing.T) {
 		ast.Equal(expect2, arg2)
 	})
 }
+
+func TestInitConfigTemplateContext(t *testing.T) {
+	ast := assert.New(t)
+	nodes := []*Node{
+		{
+			Name: "parent",
+			Host: "parent.example.com",
+			User: "${node:Name}",
+			Children: []*Node{
+				{Name: "child", Host: "child.example.com", Alias: "${node:Host}"},
+			},
+			Jump: []*Node{
+				{Name: "jump", User: "${node:Name}"},
+			},
+		},
+	}
+	ast.Nil(InitConfig(nodes))
+	ast.Equal("parent", nodes[0].User)
+	ast.Equal("child.example.com", nodes[0].Children[0].Alias)
+	ast.Equal("jump", nodes[0].Jump[0].User)
+
+	err := InitConfig([]*Node{{Name: "parent", Children: []*Node{{Name: "child", Password: "${file:/sshw/missing}"}}}})
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "node parent: node child: Password: template ${file:/sshw/missing}")
+}
+
+func TestInitConfigLazySources(t *testing.T) {
+	ast := assert.New(t)
+	nodes := []*Node{
+		{Name: "a", Password: "${exec:echo secret}", User: "${node:Password}", Host: "a.example.com", KeyPath: "${file:/sshw/missing}"},
+		{Name: "b", Alias: "${node:Name}"},
+	}
+	// exec and file are not run when loading
+	ast.Nil(initConfig(nodes, true))
+	ast.Equal("${exec:echo secret}", nodes[0].Password)
+	ast.Equal("${node:Password}", nodes[0].User)
+	ast.Equal("b", nodes[1].Alias)
+
+	// resolved for the node to connect
+	ast.NotNil(ResolveNode(nodes[0]))
+	nodes[0].KeyPath = ""
+	ast.Nil(ResolveNode(nodes[0]))
+	ast.Equal("secret", nodes[0].Password)
+	ast.Equal("secret", nodes[0].User)
+
+	// commands run again for every connection, etc. rotated password of daemon
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	password := path.Join(dir, "password")
+	_ = ioutil.WriteFile(password, []byte("old"), 0600)
+	node := &Node{Name: "c", Password: "${exec:cat " + password + "}"}
+	ast.Nil(ResolveNode(node))
+	ast.Equal("old", node.Password)
+	_ = ioutil.WriteFile(password, []byte("new"), 0600)
+	node.Password = "${exec:cat " + password + "}"
+	ast.Nil(ResolveNode(node))
+	ast.Equal("new", node.Password)
+}
+
+func TestInheritVars(t *testing.T) {
+	ast := assert.New(t)
+	nodes, err := LoadYamlConfig0([]byte(`
+- name: prod
+  vars:
+    db_user: admin
+    region: cn
+  children:
+    - name: db
+      host: db.example.com
+      user: ${db_user}
+      vars:
+        region: us
+      keypath: ~/.ssh/${region}
+    - name: web
+      user: ${db_user}
+`))
+	ast.Nil(err)
+	ast.True(IsBookmark(nodes[0]))
+	InheritVars(nodes, nil)
+	ast.Nil(InitConfig(nodes))
+	db, web := nodes[0].Children[0], nodes[0].Children[1]
+	ast.Equal("admin", db.User)
+	ast.Equal("~/.ssh/us", db.KeyPath)
+	ast.Equal("admin", web.User)
+	region, _ := web.Var("region")
+	ast.Equal("cn", region)
+
+	// vars of one node do not leak into another one
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			node := &Node{Name: strconv.Itoa(i), User: "${sshw_user}"}
+			node.SetVar("sshw_user", node.Name)
+			ast.Nil(InitConfig(node))
+			ast.Equal(node.Name, node.User)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestInheritTagsAndFilterNodes(t *testing.T) {
+	ast := assert.New(t)
+	nodes, err := LoadYamlConfig0([]byte(`
+- name: eu
+  tags: [eu]
+  children:
+    - name: db
+      host: db.eu.example.com
+      tags: [db, prod]
+    - name: web
+      host: web.eu.example.com
+      tags: [web, eu]
+- name: us
+  children:
+    - name: db
+      host: db.us.example.com
+      tags: [db]
+`))
+	ast.Nil(err)
+	ast.True(IsBookmark(nodes[0]))
+	InheritTags(nodes, nil)
+	ast.Equal([]string{"db", "prod", "eu"}, nodes[0].Children[0].Tags)
+	ast.Equal([]string{"web", "eu"}, nodes[0].Children[1].Tags)
+	ast.Equal([]string{"db"}, nodes[1].Children[0].Tags)
+
+	filtered := FilterNodes(nodes, func(node *Node) bool {
+		return hasTags(node, []string{"db"})
+	})
+	leaves, paths := LeafNodes(filtered)
+	ast.Equal([]string{"eu/db", "us/db"}, paths)
+	ast.Equal(nodes[0].Children[0], leaves[0])
+	// bookmarks are copied, children of config are kept
+	ast.Len(filtered[0].Children, 1)
+	ast.Len(nodes[0].Children, 2)
+
+	ast.Empty(FilterNodes(nodes, func(node *Node) bool {
+		return false
+	}))
+}
+
+func TestInitNodesBaseOnDefaults(t *testing.T) {
+	ast := assert.New(t)
+	nodes, err := LoadYamlConfig0([]byte(`
+- name: prod
+  defaults:
+    user: deploy
+    port: 2222
+    keypath: ~/.ssh/prod
+    jump:
+      - name: bastion
+        host: bastion.example.com
+  children:
+    - name: web
+      host: web.example.com
+    - name: db
+      defaults:
+        user: dba
+      children:
+        - name: master
+          host: master.example.com
+        - name: slave
+          host: slave.example.com
+          port: 22
+`))
+	ast.Nil(err)
+	ast.True(IsBookmark(nodes[0]))
+	InitNodesBaseOnDefaults(nodes, nil)
+	prod := nodes[0]
+	ast.Equal("", prod.User)
+	web := prod.Children[0]
+	ast.Equal("deploy", web.User)
+	ast.Equal(2222, web.Port)
+	ast.Equal("~/.ssh/prod", web.KeyPath)
+	ast.Equal("bastion.example.com", web.Jump[0].Host)
+	db := prod.Children[1]
+	ast.True(IsBookmark(db))
+	master, slave := db.Children[0], db.Children[1]
+	ast.Equal("dba", master.User)
+	ast.Equal(2222, master.Port)
+	ast.Equal("bastion.example.com", master.Jump[0].Host)
+	ast.Equal(22, slave.Port)
+}
@@ -0,0 +1,125 @@
+package sshwctl
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	CredentialPassword            = "password"
+	CredentialPassphrase          = "passphrase"
+	CredentialKeyboardInteractive = "keyboard-interactive"
+	CredentialOtp                 = "otp"
+)
+
+// a secret asked from credential helper
+type Credential struct {
+	Kind string
+	Host string
+	Port int
+	User string
+	// keyboard-interactive and otp
+	Question string
+	// passphrase
+	Path   string
+	Secret string
+}
+
+// like git-credential, helper is called as `<cmd> get|store|erase`
+// sshw writes attributes into stdin, one `key=value` per line and ends with a blank line
+//  protocol=ssh
+//  host=example.com
+//  port=22
+//  username=root
+//  kind=password
+// `get` prints `password=<secret>`, or nothing if it does not know
+// `store` and `erase` receive the same attributes with password
+type CredentialHelper struct {
+	Cmd string
+}
+
+func NewCredentialHelper(cmd string) *CredentialHelper {
+	return &CredentialHelper{Cmd: cmd}
+}
+
+// fill Secret, return false if helper does not know it
+func (h *CredentialHelper) Get(credential *Credential) (bool, error) {
+	out, err := h.run("get", credential)
+	if err != nil {
+		return false, err
+	}
+	attributes := parseCredentialAttributes(out)
+	if attributes["quit"] == "1" || attributes["quit"] == "true" {
+		return false, nil
+	}
+	secret, has := attributes["password"]
+	if !has || secret == "" {
+		return false, nil
+	}
+	credential.Secret = secret
+	return true, nil
+}
+
+func (h *CredentialHelper) Store(credential *Credential) error {
+	_, err := h.run("store", credential)
+	return err
+}
+
+func (h *CredentialHelper) Erase(credential *Credential) error {
+	_, err := h.run("erase", credential)
+	return err
+}
+
+func (h *CredentialHelper) run(action string, credential *Credential) ([]byte, error) {
+	command := exec.Command(Shell(), "-c", h.Cmd+` "$1"`, "credential-helper", action)
+	command.Stdin = bytes.NewReader(credential.attributes(action != "get"))
+	command.Stderr = os.Stderr
+	out, err := command.Output()
+	if err != nil {
+		return nil, errors.WithMessage(err, "credential-helper "+action)
+	}
+	return out, nil
+}
+
+func (c *Credential) attributes(withSecret bool) []byte {
+	buf := bytes.NewBuffer(nil)
+	write := func(key, value string) {
+		if value != "" {
+			buf.WriteString(key + "=" + value + "\n")
+		}
+	}
+	write("protocol", "ssh")
+	write("host", c.Host)
+	write("port", strconv.Itoa(c.Port))
+	write("username", c.User)
+	write("kind", c.Kind)
+	write("question", strings.TrimSpace(c.Question))
+	write("path", c.Path)
+	if withSecret {
+		write("password", c.Secret)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func parseCredentialAttributes(out []byte) map[string]string {
+	attributes := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 {
+			attributes[kv[0]] = kv[1]
+		}
+	}
+	return attributes
+}
@@ -0,0 +1,46 @@
+package sshwctl
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialHelper(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	store := path.Join(dir, "store")
+
+	// store and erase write stdin into file, get prints it
+	helper := NewCredentialHelper(`f() {
+  case "$1" in
+    get) [ ! -f ` + store + ` ] || grep '^password=' ` + store + ` ;;
+    store) cat > ` + store + ` ;;
+    erase) rm -f ` + store + ` ;;
+  esac
+}; f`)
+
+	credential := &Credential{Kind: CredentialPassword, Host: "example.com", Port: 22, User: "root"}
+	has, err := helper.Get(credential)
+	ast.Nil(err)
+	ast.False(has)
+
+	credential.Secret = "secret"
+	ast.Nil(helper.Store(credential))
+	b, _ := ioutil.ReadFile(store)
+	ast.Equal("protocol=ssh\nhost=example.com\nport=22\nusername=root\nkind=password\npassword=secret\n\n", string(b))
+
+	got := &Credential{Kind: CredentialPassword, Host: "example.com"}
+	has, err = helper.Get(got)
+	ast.Nil(err)
+	ast.True(has)
+	ast.Equal("secret", got.Secret)
+
+	ast.Nil(helper.Erase(credential))
+	has, _ = helper.Get(got)
+	ast.False(has)
+}
@@ -39,4 +39,7 @@ const (
 	OnStdout             = "OnStdout"
 	OnStderr             = "OnStderr"
 	PostShell            = "PostShell"
+	PostSessionEnd       = "PostSessionEnd"
+	OnAuthFailure        = "OnAuthFailure"
+	PostClose            = "PostClose"
 )
@@ -0,0 +1,225 @@
+package sshwctl
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const maxExpandedNodes = 10000
+
+var (
+	// vars of expanded values, in order of range, for-each and ranges of host
+	// nested nodes continue with the next var, etc. bookmark of for-each has i, its children have j
+	expandVars = []string{"i", "j", "k"}
+	// [01-12], [a,b,c] or [1-3,7], ipv6 like [::1] is not a range
+	hostRangeRegexp   = regexp.MustCompile(`\[([0-9A-Za-z_.-]+(?:,[0-9A-Za-z_.-]+)*)\]`)
+	numberRangeRegexp = regexp.MustCompile(`^(\d+)-(\d+)$`)
+)
+
+// expand nodes with range, for-each or ranges in host into nodes
+// etc. `{name: web-${i}, host: web[01-12].prod.example.com}` is web-01 ... web-12
+// every expanded node is a copy of node, its values are vars i, j and k
+// vars in name or alias are replaced, if they do not use vars, values are appended, etc. web-01
+func ExpandNodes(nodes []*Node) ([]*Node, error) {
+	return expandNodes(nodes, 0)
+}
+
+// used is the count of vars used by ancestors
+func expandNodes(nodes []*Node, used int) ([]*Node, error) {
+	var expanded []*Node
+	for _, node := range nodes {
+		list, err := expandNode(node, used)
+		if err != nil {
+			return nil, errors.WithMessage(err, "node "+node.Name)
+		}
+		expanded = append(expanded, list...)
+	}
+	return expanded, nil
+}
+
+func expandNode(node *Node, used int) ([]*Node, error) {
+	var lists [][]string
+	if node.Range != "" {
+		values, err := parseRange(node.Range)
+		if err != nil {
+			return nil, errors.WithMessage(err, "range")
+		}
+		lists = append(lists, values)
+	}
+	if len(node.ForEach) != 0 {
+		lists = append(lists, node.ForEach)
+	}
+	hostParts, hostLists, err := splitHostRanges(node.Host)
+	if err != nil {
+		return nil, errors.WithMessage(err, "host")
+	}
+	lists = append(lists, hostLists...)
+	if used+len(lists) > len(expandVars) {
+		return nil, errors.Errorf("at most %d ranges, for-each and ranges of ancestors are counted", len(expandVars))
+	}
+
+	children, err := expandNodes(node.Children, used+len(lists))
+	if err != nil {
+		return nil, err
+	}
+	node.Children = children
+	if len(lists) == 0 {
+		return []*Node{node}, nil
+	}
+	node.Range, node.ForEach = "", nil
+
+	count := 1
+	for _, list := range lists {
+		count *= len(list)
+		if count > maxExpandedNodes {
+			return nil, errors.Errorf("more than %d nodes are expanded", maxExpandedNodes)
+		}
+	}
+	b, err := yaml.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	expanded := make([]*Node, 0, count)
+	for _, values := range combineValues(lists) {
+		c := new(Node)
+		if err := yaml.Unmarshal(b, c); err != nil {
+			return nil, err
+		}
+		vars := make(map[string]string, len(values))
+		for i, value := range values {
+			c.SetVar(expandVars[used+i], value)
+			vars[expandVars[used+i]] = value
+		}
+		if len(hostLists) != 0 {
+			hostValues := values[len(values)-len(hostLists):]
+			var host strings.Builder
+			for i, part := range hostParts {
+				host.WriteString(part)
+				if i < len(hostValues) {
+					host.WriteString(hostValues[i])
+				}
+			}
+			c.Host = host.String()
+		}
+		suffix := strings.Join(values, "-")
+		if !usesVars(c.Name, vars) {
+			c.Name = strings.TrimPrefix(c.Name+"-"+suffix, "-")
+		}
+		if c.Alias != "" && !usesVars(c.Alias, vars) {
+			c.Alias += "-" + suffix
+		}
+		replaceNameVars(c, vars)
+		expanded = append(expanded, c)
+	}
+	return expanded, nil
+}
+
+// s has ${i}, ${j} or ${k} of vars
+func usesVars(s string, vars map[string]string) bool {
+	for name := range vars {
+		if strings.Contains(s, "${"+name+"}") {
+			return true
+		}
+	}
+	return false
+}
+
+// replace vars in name and alias of node and its children, etc. web-${i} is web-01
+// names of expanded nodes are distinct, merging of config does not collapse them
+// other templates of name are rendered later
+func replaceNameVars(node *Node, vars map[string]string) {
+	for name, value := range vars {
+		node.Name = strings.Replace(node.Name, "${"+name+"}", value, -1)
+		node.Alias = strings.Replace(node.Alias, "${"+name+"}", value, -1)
+	}
+	for _, child := range node.Children {
+		replaceNameVars(child, vars)
+	}
+}
+
+// values of range, items are separated by comma, etc. 01-12 is 01, 02 ... 12, 1-3,7 is 1, 2, 3, 7
+// other items are values themselves
+func parseRange(s string) ([]string, error) {
+	var values []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, errors.Errorf("empty item in %s", s)
+		}
+		match := numberRangeRegexp.FindStringSubmatch(item)
+		if match == nil {
+			values = append(values, item)
+			continue
+		}
+		start, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		end, err := strconv.Atoi(match[2])
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, errors.Errorf("start of %s is greater than end", item)
+		}
+		if end-start >= maxExpandedNodes {
+			return nil, errors.Errorf("%s has more than %d values", item, maxExpandedNodes)
+		}
+		// zero-padded, etc. 01-12
+		width := 0
+		if len(match[1]) > 1 && match[1][0] == '0' {
+			width = len(match[1])
+		}
+		for n := start; n <= end; n++ {
+			value := strconv.Itoa(n)
+			if len(value) < width {
+				value = strings.Repeat("0", width-len(value)) + value
+			}
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// literal parts around ranges of host, len(parts) is len(lists)+1
+func splitHostRanges(host string) ([]string, [][]string, error) {
+	matches := hostRangeRegexp.FindAllStringSubmatchIndex(host, -1)
+	if len(matches) == 0 {
+		return nil, nil, nil
+	}
+	var parts []string
+	var lists [][]string
+	last := 0
+	for _, match := range matches {
+		values, err := parseRange(host[match[2]:match[3]])
+		if err != nil {
+			return nil, nil, err
+		}
+		parts = append(parts, host[last:match[0]])
+		lists = append(lists, values)
+		last = match[1]
+	}
+	parts = append(parts, host[last:])
+	return parts, lists, nil
+}
+
+// cartesian product of lists, the last list changes fastest
+func combineValues(lists [][]string) [][]string {
+	combinations := [][]string{nil}
+	for _, list := range lists {
+		var next [][]string
+		for _, combination := range combinations {
+			for _, value := range list {
+				values := make([]string, len(combination), len(combination)+1)
+				copy(values, combination)
+				next = append(next, append(values, value))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
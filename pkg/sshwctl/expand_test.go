@@ -0,0 +1,97 @@
+package sshwctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandNodes(t *testing.T) {
+	ast := assert.New(t)
+	nodes, err := LoadYamlConfig0([]byte(`
+- name: web-${i}
+  host: web[01-03].prod.example.com
+  user: deploy
+  tags: [web]
+- name: cache
+  host: cache-[a,b]-[8-9].example.com
+- name: db
+  range: 1-2,7
+  host: db${i}.example.com
+  alias: db
+- name: ${i}
+  for-each: [eu, us]
+  children:
+    - name: k8s
+      host: k8s[1-2].${i}.example.com
+- name: v6
+  host: "[::1]"
+`))
+	ast.Nil(err)
+
+	var names, hosts []string
+	for _, node := range nodes {
+		names = append(names, node.Name)
+		hosts = append(hosts, node.Host)
+	}
+	ast.Equal([]string{"web-01", "web-02", "web-03", "cache-a-8", "cache-a-9", "cache-b-8", "cache-b-9", "db-1", "db-2", "db-7", "eu", "us", "v6"}, names)
+	ast.Equal("web01.prod.example.com", hosts[0])
+	ast.Equal("web03.prod.example.com", hosts[2])
+	ast.Equal("cache-b-9.example.com", hosts[6])
+	ast.Equal("[::1]", hosts[12])
+
+	// settings of template are copied
+	ast.Equal("deploy", nodes[1].User)
+	ast.Equal([]string{"web"}, nodes[1].Tags)
+	nodes[1].Tags[0] = "changed"
+	ast.Equal("web", nodes[0].Tags[0])
+	ast.Empty(nodes[7].Range)
+	ast.Equal("db-7", nodes[9].Alias)
+	ast.Equal("k8s-1", nodes[10].Children[0].Name)
+
+	// vars are rendered by templates
+	ast.Nil(InitNodes(nodes))
+	ast.Equal("web-02", nodes[1].Name)
+	ast.Equal("db7.example.com", nodes[9].Host)
+	ast.Equal("us", nodes[11].Name)
+	ast.Len(nodes[11].Children, 2)
+	ast.Equal("k8s-2", nodes[11].Children[1].Name)
+	ast.Equal("k8s2.us.example.com", nodes[11].Children[1].Host)
+	j, _ := nodes[11].Children[1].Var("j")
+	ast.Equal("2", j)
+}
+
+func TestExpandNodes_Error(t *testing.T) {
+	ast := assert.New(t)
+	_, err := LoadYamlConfig0([]byte(`
+- name: web
+  host: web[12-01].example.com
+`))
+	ast.EqualError(err, "node web: host: start of 12-01 is greater than end")
+
+	_, err = LoadYamlConfig0([]byte(`
+- name: web
+  range: 1-2
+  for-each: [a, b]
+  host: web[1-2][1-2]
+`))
+	ast.EqualError(err, "node web: at most 3 ranges, for-each and ranges of ancestors are counted")
+
+	_, err = LoadYamlConfig0([]byte(`
+- name: web
+  host: web[1-200][1-200].example.com
+`))
+	ast.EqualError(err, "node web: more than 10000 nodes are expanded")
+}
+
+func TestParseRange(t *testing.T) {
+	ast := assert.New(t)
+	values, err := parseRange("08-11")
+	ast.Nil(err)
+	ast.Equal([]string{"08", "09", "10", "11"}, values)
+	values, err = parseRange("9-10, a, 001-002")
+	ast.Nil(err)
+	ast.Equal([]string{"9", "10", "a", "001", "002"}, values)
+	_, err = parseRange("1,,2")
+	ast.NotNil(err)
+}
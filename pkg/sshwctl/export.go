@@ -0,0 +1,246 @@
+package sshwctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// separator of hierarchical Host alias, etc. `prod/web-1`, it is the separator of node paths
+// names are hostnames or ips usually, / in names is replaced, so aliases are not ambiguous
+const ExportAliasSeparator = "/"
+
+// find node by names of path, etc. `prod/web`
+func FindSubtree(nodes []*Node, subtree string) (*Node, string, error) {
+	names := strings.FieldsFunc(subtree, func(r rune) bool {
+		return r == '/'
+	})
+	if len(names) == 0 {
+		return nil, "", errors.Errorf("invalid subtree %s", subtree)
+	}
+	var node *Node
+	var parents []string
+	for i, name := range names {
+		node = nil
+		for _, n := range nodes {
+			if n.Name == name || (n.Alias != "" && n.Alias == name) {
+				node = n
+				break
+			}
+		}
+		if node == nil {
+			return nil, "", errors.Errorf("subtree %s is not found", strings.Join(names[:i+1], "/"))
+		}
+		parents = append(parents, exportName(node))
+		nodes = node.Children
+	}
+	return node, strings.Join(parents[:len(parents)-1], ExportAliasSeparator), nil
+}
+
+// write nodes as OpenSSH config, bookmarks are flattened into hierarchical Host aliases
+// password, passphrase and answers are never written, warnings are written into warn
+func ExportSshConfig(w io.Writer, nodes []*Node, prefix string, warn io.Writer) error {
+	e := &sshConfigExporter{w: bufio.NewWriter(w), warn: warn, aliases: map[string]bool{}}
+	e.println("# generated by sshw export ssh-config")
+	for _, node := range nodes {
+		e.export(node, prefix)
+	}
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+type sshConfigExporter struct {
+	w       *bufio.Writer
+	warn    io.Writer
+	aliases map[string]bool
+	// Host of options being written
+	alias string
+	err   error
+}
+
+func (e *sshConfigExporter) println(a ...interface{}) {
+	if e.err == nil {
+		_, e.err = fmt.Fprintln(e.w, a...)
+	}
+}
+
+func (e *sshConfigExporter) option(key, value string) {
+	if value == "" || e.lazy(key, value) {
+		return
+	}
+	e.println("  " + key + " " + quoteSshConfig(value))
+}
+
+// ${exec:xxx} and ${file:xxx} are resolved when connecting, see ResolveNode
+// they are not run by export, the option is skipped
+func (e *sshConfigExporter) lazy(key, value string) bool {
+	for _, param := range ParseSshwTemplate(value).Templates {
+		if param.Type != TypeParam {
+			continue
+		}
+		prefix := strings.TrimSpace(strings.SplitN(param.Value[2:len(param.Value)-1], ":", 2)[0])
+		if prefix == "exec" || prefix == "file" {
+			e.warnf("%s: %s %s is resolved when connecting, it is not exported", e.alias, key, param.Value)
+			return true
+		}
+	}
+	return false
+}
+
+func (e *sshConfigExporter) warnf(format string, args ...interface{}) {
+	if e.warn != nil {
+		_, _ = fmt.Fprintf(e.warn, "warning: "+format+"\n", args...)
+	}
+}
+
+func (e *sshConfigExporter) export(node *Node, prefix string) {
+	alias := exportName(node)
+	if prefix != "" {
+		alias = prefix + ExportAliasSeparator + alias
+	}
+	if node.Host != "" {
+		e.host(node, alias)
+	}
+	for _, child := range node.Children {
+		e.export(child, alias)
+	}
+}
+
+func (e *sshConfigExporter) host(node *Node, alias string) {
+	if e.aliases[alias] {
+		e.warnf("%s is duplicate, only the first one is used by ssh", alias)
+	}
+	e.aliases[alias] = true
+	e.warnSecrets(node, alias)
+
+	e.alias = alias
+	e.println()
+	e.println("Host", alias)
+	e.option("HostName", node.Host)
+	e.options(node)
+
+	var jumps []string
+	var jumpHosts []*Node
+	var jumpAliases []string
+	for i, jump := range node.Jump {
+		if jump.Host == "" {
+			continue
+		}
+		e.warnSecrets(jump, alias+" jump")
+		// ProxyJump only carries user, host and port, other options need a Host of its own
+		if jump.KeyPath == "" && jump.CertificateFile == "" && jump.UserKnownHostsFile == "" && jump.StrictHostKeyChecking == "" {
+			jumps = append(jumps, exportJumpAddr(jump))
+			continue
+		}
+		jumpAlias := alias + ExportAliasSeparator + "jump" + strconv.Itoa(i)
+		jumps = append(jumps, jumpAlias)
+		jumpHosts = append(jumpHosts, jump)
+		jumpAliases = append(jumpAliases, jumpAlias)
+	}
+	if len(jumps) != 0 {
+		if node.ProxyCommand != "" {
+			e.warnf("%s: proxy-command is not exported, ssh does not use it with ProxyJump", alias)
+		}
+		e.option("ProxyJump", strings.Join(jumps, ","))
+	} else if node.ProxyCommand != "" && !e.lazy("ProxyCommand", node.ProxyCommand) {
+		// rest of line is the command, it is not quoted
+		e.println("  ProxyCommand " + node.ProxyCommand)
+	}
+	for i, jump := range jumpHosts {
+		e.alias = jumpAliases[i]
+		e.println()
+		e.println("Host", jumpAliases[i])
+		e.option("HostName", jump.Host)
+		e.options(jump)
+	}
+}
+
+func (e *sshConfigExporter) options(node *Node) {
+	if node.User != "$USER" {
+		e.option("User", node.User)
+	}
+	if node.Port > 0 {
+		e.option("Port", strconv.Itoa(node.Port))
+	}
+	e.option("IdentityFile", node.KeyPath)
+	for _, identityFile := range node.IdentityFiles {
+		e.option("IdentityFile", identityFile)
+	}
+	e.option("CertificateFile", node.CertificateFile)
+	for _, forward := range node.LocalForward {
+		e.println("  LocalForward " + forward)
+	}
+	for _, forward := range node.RemoteForward {
+		e.println("  RemoteForward " + forward)
+	}
+	if node.ServerAliveInterval > 0 {
+		e.option("ServerAliveInterval", strconv.Itoa(int(node.ServerAliveInterval.Seconds())))
+	}
+	if node.ServerAliveCountMax > 0 {
+		e.option("ServerAliveCountMax", strconv.Itoa(node.ServerAliveCountMax))
+	}
+	e.option("StrictHostKeyChecking", node.StrictHostKeyChecking)
+	e.option("UserKnownHostsFile", node.UserKnownHostsFile)
+	if node.BatchMode {
+		e.option("BatchMode", "yes")
+	}
+}
+
+func (e *sshConfigExporter) warnSecrets(node *Node, alias string) {
+	var fields []string
+	if node.Password != "" {
+		fields = append(fields, "password")
+	}
+	if node.Passphrase != "" {
+		fields = append(fields, "passphrase")
+	}
+	for _, interaction := range node.KeyboardInteractions {
+		if interaction.Answer != "" {
+			fields = append(fields, "keyboard-interactions")
+			break
+		}
+	}
+	if len(fields) != 0 {
+		e.warnf("%s: %s is not exported", alias, strings.Join(fields, ", "))
+	}
+}
+
+// name of node in Host alias, whitespace, patterns and separator are replaced by -
+func exportName(node *Node) string {
+	name := node.Name
+	if name == "" {
+		name = node.Alias
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '*', '?', '!', ',', '"', '/':
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+// [user@]host[:port]
+func exportJumpAddr(jump *Node) string {
+	addr := jump.Host
+	if jump.User != "" && jump.User != "$USER" {
+		addr = jump.User + "@" + addr
+	}
+	if jump.Port > 0 {
+		addr += ":" + strconv.Itoa(jump.Port)
+	}
+	return addr
+}
+
+func quoteSshConfig(value string) string {
+	if strings.ContainsAny(value, " \t") && !strings.HasPrefix(value, `"`) {
+		return `"` + value + `"`
+	}
+	return value
+}
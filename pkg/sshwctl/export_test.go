@@ -0,0 +1,72 @@
+package sshwctl
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportSshConfig(t *testing.T) {
+	ast := assert.New(t)
+	nodes := []*Node{
+		{Name: "prod", Children: []*Node{
+			{Name: "web 1", Host: "10.0.0.1", User: "root", Port: 2222, KeyPath: "/keys/prod", Password: "secret",
+				Jump: []*Node{
+					{Host: "bastion", User: "jump"},
+					{Host: "10.0.0.254", KeyPath: "/keys/inner"},
+				}},
+			{Name: "db", Host: "10.0.0.2", ServerAliveInterval: 30 * time.Second, ProxyCommand: "nc %h %p",
+				LocalForward: []string{"5432 localhost:5432"}},
+			{Name: "10.0.0.3", Host: "10.0.0.3", KeyPath: "${file:~/.ssh/key-path}"},
+		}},
+	}
+	out := bytes.NewBuffer(nil)
+	warn := bytes.NewBuffer(nil)
+	ast.Nil(ExportSshConfig(out, nodes, "", warn))
+	ast.Equal(`# generated by sshw export ssh-config
+
+Host prod/web-1
+  HostName 10.0.0.1
+  User root
+  Port 2222
+  IdentityFile /keys/prod
+  ProxyJump jump@bastion,prod/web-1/jump1
+
+Host prod/web-1/jump1
+  HostName 10.0.0.254
+  IdentityFile /keys/inner
+
+Host prod/db
+  HostName 10.0.0.2
+  LocalForward 5432 localhost:5432
+  ServerAliveInterval 30
+  ProxyCommand nc %h %p
+
+Host prod/10.0.0.3
+  HostName 10.0.0.3
+`, out.String())
+	ast.Equal("warning: prod/web-1: password is not exported\n"+
+		"warning: prod/10.0.0.3: IdentityFile ${file:~/.ssh/key-path} is resolved when connecting, it is not exported\n", warn.String())
+
+	// exported config is read by ssh config loader
+	cfg, err := ParseSshConfig(bytes.NewReader(out.Bytes()), "")
+	ast.Nil(err)
+	web, err := cfg.Node("prod/web-1")
+	ast.Nil(err)
+	ast.Equal("10.0.0.1", web.Host)
+	ast.Len(web.Jump, 2)
+	ast.Equal("/keys/inner", web.Jump[1].KeyPath)
+
+	node, prefix, err := FindSubtree(nodes, "prod/db")
+	ast.Nil(err)
+	ast.Equal("prod", prefix)
+	ast.Equal("10.0.0.2", node.Host)
+	// dots are part of names
+	node, _, err = FindSubtree(nodes, "prod/10.0.0.3")
+	ast.Nil(err)
+	ast.Equal("10.0.0.3", node.Host)
+	_, _, err = FindSubtree(nodes, "prod/cache")
+	ast.NotNil(err)
+}
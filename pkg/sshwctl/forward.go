@@ -0,0 +1,93 @@
+package sshwctl
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// port forwarding like ssh -L and -R
+// spec is `[bind_address:]port host:hostport`, bind address is localhost by default
+type Forward struct {
+	Listen string
+	Target string
+}
+
+func ParseForward(spec string) (*Forward, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return nil, errors.Errorf("invalid forward %s", spec)
+	}
+	listen := fields[0]
+	if _, err := strconv.Atoi(listen); err == nil {
+		listen = net.JoinHostPort("localhost", listen)
+	} else if _, _, err := net.SplitHostPort(listen); err != nil {
+		return nil, errors.Errorf("invalid forward %s: %v", spec, err)
+	}
+	if _, _, err := net.SplitHostPort(fields[1]); err != nil {
+		return nil, errors.Errorf("invalid forward %s: %v", spec, err)
+	}
+	return &Forward{Listen: listen, Target: fields[1]}, nil
+}
+
+// listen local address, connections are forwarded to target through client
+func (f *Forward) StartLocal(client *ssh.Client) (net.Listener, error) {
+	listener, err := net.Listen("tcp", f.Listen)
+	if err != nil {
+		return nil, err
+	}
+	go f.serve(listener, func() (net.Conn, error) {
+		return client.Dial("tcp", f.Target)
+	})
+	go closeWithClient(client, listener)
+	return listener, nil
+}
+
+// listen remote address, connections are forwarded to local target
+func (f *Forward) StartRemote(client *ssh.Client) (net.Listener, error) {
+	listener, err := client.Listen("tcp", f.Listen)
+	if err != nil {
+		return nil, err
+	}
+	go f.serve(listener, func() (net.Conn, error) {
+		return net.Dial("tcp", f.Target)
+	})
+	go closeWithClient(client, listener)
+	return listener, nil
+}
+
+func (f *Forward) serve(listener net.Listener, dial func() (net.Conn, error)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			target, err := dial()
+			if err != nil {
+				return
+			}
+			defer target.Close()
+			done := make(chan struct{}, 2)
+			go func() {
+				_, _ = io.Copy(target, conn)
+				done <- struct{}{}
+			}()
+			go func() {
+				_, _ = io.Copy(conn, target)
+				done <- struct{}{}
+			}()
+			<-done
+		}()
+	}
+}
+
+func closeWithClient(client *ssh.Client, listener net.Listener) {
+	_ = client.Wait()
+	_ = listener.Close()
+}
@@ -0,0 +1,92 @@
+package sshwctl
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	StrictHostKeyCheckingYes       = "yes"
+	StrictHostKeyCheckingAcceptNew = "accept-new"
+	StrictHostKeyCheckingAsk       = "ask"
+	StrictHostKeyCheckingNo        = "no"
+)
+
+var defaultKnownHostsFile = path.Join(homeDir, ".ssh/known_hosts")
+
+func (n *Node) knownHostsFile() string {
+	if n.UserKnownHostsFile != "" {
+		return n.UserKnownHostsFile
+	}
+	return defaultKnownHostsFile
+}
+
+// verify host key by known_hosts like ssh
+// yes: unknown host is rejected
+// accept-new: unknown host is added into known_hosts
+// ask: ask user before adding unknown host
+// no or empty: host key is not verified
+// changed host key is always rejected unless no
+func HostKeyCallback(node *Node) ssh.HostKeyCallback {
+	mode := strings.ToLower(node.StrictHostKeyChecking)
+	switch mode {
+	case "", StrictHostKeyCheckingNo, "off":
+		return ssh.InsecureIgnoreHostKey()
+	case "true", "on":
+		mode = StrictHostKeyCheckingYes
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		filename := node.knownHostsFile()
+		if _, err := os.Stat(filename); err == nil {
+			callback, err := knownhosts.New(filename)
+			if err != nil {
+				return errors.WithMessage(err, "read known hosts")
+			}
+			err = callback(hostname, remote, key)
+			keyErr, ok := err.(*knownhosts.KeyError)
+			if !ok || len(keyErr.Want) != 0 {
+				if ok {
+					return errors.Errorf("host key of %s has changed, it is different from %s:%d", hostname, keyErr.Want[0].Filename, keyErr.Want[0].Line)
+				}
+				return err
+			}
+		}
+
+		// unknown host
+		fingerprint := ssh.FingerprintSHA256(key)
+		switch mode {
+		case StrictHostKeyCheckingAcceptNew:
+		case StrictHostKeyCheckingAsk:
+			answer, err := NewPrompter(node).Prompt(fmt.Sprintf("The authenticity of host '%s' can't be established.\r\n%s key fingerprint is %s.\r\nAre you sure you want to continue connecting (yes/no)? ", hostname, key.Type(), fingerprint), true)
+			if err != nil {
+				return err
+			}
+			if strings.ToLower(strings.TrimSpace(answer)) != "yes" {
+				return errors.Errorf("host key verification failed: %s", hostname)
+			}
+		default:
+			return errors.Errorf("host key verification failed: %s %s is unknown", hostname, fingerprint)
+		}
+		return addKnownHost(filename, hostname, key)
+	}
+}
+
+func addKnownHost(filename, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(path.Dir(filename), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.WithMessage(err, "write known hosts")
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	return err
+}
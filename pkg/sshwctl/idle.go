@@ -0,0 +1,98 @@
+package sshwctl
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrIdleTimeout = errors.New("session is closed because of idle timeout")
+
+// watch traffic of session
+// if there is no traffic in Timeout, warn user first and then expire session
+type IdleWatcher struct {
+	Timeout time.Duration
+	// unix nano of last traffic
+	last int64
+}
+
+func NewIdleWatcher(timeout time.Duration) *IdleWatcher {
+	w := &IdleWatcher{Timeout: timeout}
+	w.Touch()
+	return w
+}
+
+// record traffic
+func (w *IdleWatcher) Touch() {
+	atomic.StoreInt64(&w.last, time.Now().UnixNano())
+}
+
+// every read of reader is traffic, etc. output without newline and stderr
+// w may be nil if idle-timeout is not set
+func (w *IdleWatcher) watchReader(getReader func() (io.Reader, error)) func() (io.Reader, error) {
+	if w == nil {
+		return getReader
+	}
+	return func() (io.Reader, error) {
+		r, err := getReader()
+		if err != nil {
+			return nil, err
+		}
+		return io.TeeReader(r, WriterFunc(func(p []byte) (int, error) {
+			w.Touch()
+			return len(p), nil
+		})), nil
+	}
+}
+
+func (w *IdleWatcher) Idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&w.last)))
+}
+
+// warn before expire, a tenth of timeout and one minute at most
+func (w *IdleWatcher) grace() time.Duration {
+	grace := w.Timeout / 10
+	if grace > time.Minute {
+		return time.Minute
+	}
+	return grace
+}
+
+// block until ctx is done or session is expired
+// warn is called once when idle reaches Timeout - grace, and it is reset by traffic
+func (w *IdleWatcher) Watch(ctx context.Context, warn func(remain time.Duration), expire func()) {
+	interval := w.grace() / 4
+	if interval > time.Second {
+		interval = time.Second
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var warned bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			idle := w.Idle()
+			if idle >= w.Timeout {
+				expire()
+				return
+			}
+			if idle < w.Timeout-w.grace() {
+				warned = false
+				continue
+			}
+			if !warned {
+				warned = true
+				warn(w.Timeout - idle)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package sshwctl
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleWatcher(t *testing.T) {
+	ast := assert.New(t)
+
+	watcher := NewIdleWatcher(200 * time.Millisecond)
+	var warned, expired bool
+	done := make(chan struct{})
+	go func() {
+		watcher.Watch(context.Background(), func(remain time.Duration) {
+			warned = true
+			ast.True(remain <= 20*time.Millisecond)
+		}, func() {
+			expired = true
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watcher is not expired")
+	}
+	ast.True(warned)
+	ast.True(expired)
+}
+
+func TestIdleWatcherTouch(t *testing.T) {
+	ast := assert.New(t)
+
+	watcher := NewIdleWatcher(100 * time.Millisecond)
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	var expired bool
+	done := make(chan struct{})
+	go func() {
+		watcher.Watch(ctx, func(remain time.Duration) {}, func() {
+			expired = true
+		})
+		close(done)
+	}()
+	for i := 0; i < 10; i++ {
+		time.Sleep(30 * time.Millisecond)
+		watcher.Touch()
+	}
+	cancelFunc()
+	<-done
+	ast.False(expired)
+}
+
+func TestIdleWatcherWatchReader(t *testing.T) {
+	ast := assert.New(t)
+
+	watcher := NewIdleWatcher(time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	r, err := watcher.watchReader(func() (io.Reader, error) {
+		return strings.NewReader("progress 50%\r"), nil
+	})()
+	ast.Nil(err)
+	ast.True(watcher.Idle() >= 20*time.Millisecond)
+	// output without newline is traffic
+	_, _ = ioutil.ReadAll(r)
+	ast.True(watcher.Idle() < 20*time.Millisecond)
+
+	var nilWatcher *IdleWatcher
+	r, _ = nilWatcher.watchReader(func() (io.Reader, error) {
+		return strings.NewReader("a"), nil
+	})()
+	ast.NotNil(r)
+}
@@ -0,0 +1,247 @@
+package sshwctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// every *.yaml in it is merged into config
+	SshwConfigDir = path.Join(SshwDir, "config.d")
+)
+
+// top level document without name
+// etc. `include: [prod.yaml, ~/.sshw.d/*.yaml]`, inventory see inventory.go
+type configDocument struct {
+	Include   []string           `yaml:"include,omitempty"`
+	Inventory []*InventorySource `yaml:"inventory,omitempty"`
+}
+
+// load config like LoadYamlConfig, and resolve includes
+// 1. team config synced into TeamConfigDir, see sync.go, it is skipped with a warning if it is broken
+// 2. include of top level and bookmarks, path is relative to the including file
+// 3. merge *.yaml in SshwConfigDir by LayerNodes
+// later layer overrides nodes of former layer
+func LoadYamlConfigs(filename string) (string, []*Node, error) {
+	matches, _ := filepath.Glob(path.Join(SshwConfigDir, "*.yaml"))
+	sort.Strings(matches)
+
+	nodes, err := LoadTeamConfig()
+	if err != nil {
+		// a bad commit of team config does not lock everyone out of personal config
+		_, _ = fmt.Fprintf(os.Stderr, "load team yaml: %v, it is skipped\n", err)
+		nodes = nil
+	}
+	pathname, b, err := ReadConfigBytes(filename)
+	if err != nil {
+		// default config is optional if there is config.d or team config
+		if filename != "" || (len(matches) == 0 && len(nodes) == 0) {
+			return "", nil, errors.WithMessage(err, "load yaml")
+		}
+	} else {
+		personal, err := loadIncludedYaml(pathname, b, nil)
+		if err != nil {
+			return "", nil, errors.WithMessage(err, "load yaml")
+		}
+		if len(nodes) == 0 {
+			nodes = personal
+		} else {
+			LayerNodes(&nodes, personal)
+		}
+	}
+
+	for _, match := range matches {
+		if match == pathname {
+			continue
+		}
+		b, err := ioutil.ReadFile(match)
+		if err != nil {
+			return "", nil, errors.WithMessage(err, "load yaml")
+		}
+		dNodes, err := loadIncludedYaml(match, b, nil)
+		if err != nil {
+			return "", nil, errors.WithMessage(err, "load yaml")
+		}
+		LayerNodes(&nodes, dNodes)
+	}
+	return pathname, nodes, nil
+}
+
+// stack is files being loaded, to detect cycle
+func loadIncludedYaml(pathname string, b []byte, stack []string) ([]*Node, error) {
+	for _, loading := range stack {
+		if loading == pathname {
+			return nil, errors.Errorf("include cycle: %s", strings.Join(append(stack, pathname), " -> "))
+		}
+	}
+	stack = append(stack, pathname)
+
+	nodes, err := LoadYamlConfig0(b)
+	if err != nil {
+		return nil, errors.WithMessage(err, pathname)
+	}
+	document := new(configDocument)
+	if err := LoadYamlSettings(b, document); err != nil {
+		return nil, errors.WithMessage(err, pathname)
+	}
+	included, err := loadIncludes(pathname, document.Include, stack)
+	if err != nil {
+		return nil, err
+	}
+	LayerNodes(&nodes, included)
+	LayerNodes(&nodes, LoadInventories(document.Inventory))
+	if err := resolveNodeIncludes(pathname, nodes, stack); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// include of bookmark becomes its children
+func resolveNodeIncludes(pathname string, nodes []*Node, stack []string) error {
+	for _, node := range nodes {
+		if len(node.Include) != 0 {
+			included, err := loadIncludes(pathname, node.Include, stack)
+			if err != nil {
+				return errors.WithMessage(err, "node "+node.Name)
+			}
+			LayerNodes(&node.Children, included)
+			// children are resolved relative to their own file
+			node.Include = nil
+		}
+		if err := resolveNodeIncludes(pathname, node.Children, stack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadIncludes(pathname string, includes []string, stack []string) ([]*Node, error) {
+	var nodes []*Node
+	for _, include := range includes {
+		filenames, err := resolveInclude(pathname, include)
+		if err != nil {
+			return nil, err
+		}
+		for _, filename := range filenames {
+			includedPathname, b, err := ReadConfigBytes(filename)
+			if err != nil {
+				return nil, errors.WithMessage(err, "include "+include)
+			}
+			included, err := loadIncludedYaml(includedPathname, b, stack)
+			if err != nil {
+				return nil, err
+			}
+			LayerNodes(&nodes, included)
+		}
+	}
+	return nodes, nil
+}
+
+// return urls or absolute paths of include, glob without match returns nothing
+func resolveInclude(pathname, include string) ([]string, error) {
+	if uri, err := url.ParseRequestURI(include); err == nil && uri.Host != "" {
+		return []string{include}, nil
+	}
+	// relative to remote config
+	if base, err := url.ParseRequestURI(pathname); err == nil && base.Host != "" {
+		if strings.HasPrefix(include, "~") || path.IsAbs(include) {
+			return nil, errors.Errorf("remote config %s can not include local file %s", pathname, include)
+		}
+		ref, err := url.Parse(include)
+		if err != nil {
+			return nil, errors.WithMessage(err, "include "+include)
+		}
+		return []string{base.ResolveReference(ref).String()}, nil
+	}
+
+	p := include
+	if strings.HasPrefix(p, "~") {
+		p = path.Join(homeDir, p[1:])
+	} else if !filepath.IsAbs(p) {
+		p = filepath.Join(filepath.Dir(pathname), p)
+	}
+	matches, err := filepath.Glob(p)
+	if err != nil {
+		return nil, errors.WithMessage(err, "include "+include)
+	}
+	if len(matches) == 0 && !strings.ContainsAny(p, "*?[") {
+		return nil, errors.Errorf("include %s: %s does not exist", include, p)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// files and urls read by LoadYamlConfigs and global config, includes are listed after the including file
+// etc. to rewrite secrets of every file
+func ConfigFiles(filename string) ([]string, error) {
+	var files []string
+	if _, err := os.Stat(SshwGlobalConfigPath); err == nil {
+		files = append(files, SshwGlobalConfigPath)
+	}
+	roots := TeamConfigFiles()
+	if pathname, _, err := ReadConfigBytes(filename); err == nil {
+		roots = append(roots, pathname)
+	} else if filename != "" {
+		return nil, err
+	}
+	matches, _ := filepath.Glob(path.Join(SshwConfigDir, "*.yaml"))
+	sort.Strings(matches)
+	roots = append(roots, matches...)
+	for _, root := range roots {
+		var err error
+		if files, err = appendIncludedFiles(files, root); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func appendIncludedFiles(files []string, pathname string) ([]string, error) {
+	for _, file := range files {
+		if file == pathname {
+			return files, nil
+		}
+	}
+	files = append(files, pathname)
+	_, b, err := ReadConfigBytes(pathname)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := LoadYamlConfig0(b)
+	if err != nil {
+		return nil, errors.WithMessage(err, pathname)
+	}
+	document := new(configDocument)
+	if err := LoadYamlSettings(b, document); err != nil {
+		return nil, errors.WithMessage(err, pathname)
+	}
+	includes := document.Include
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, node := range nodes {
+			includes = append(includes, node.Include...)
+			walk(node.Children)
+		}
+	}
+	walk(nodes)
+	for _, include := range includes {
+		filenames, err := resolveInclude(pathname, include)
+		if err != nil {
+			return nil, err
+		}
+		for _, filename := range filenames {
+			if files, err = appendIncludedFiles(files, filename); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
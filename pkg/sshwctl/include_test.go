@@ -0,0 +1,120 @@
+package sshwctl
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadYamlConfigs(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	configDir := SshwConfigDir
+	SshwConfigDir = path.Join(dir, "config.d")
+	defer func() {
+		SshwConfigDir = configDir
+	}()
+	write := func(name, content string) string {
+		filename := path.Join(dir, name)
+		_ = os.MkdirAll(path.Dir(filename), 0755)
+		_ = ioutil.WriteFile(filename, []byte(content), 0644)
+		return filename
+	}
+
+	main := write("sshw.yaml", `
+include: [env/dev.yaml]
+---
+- name: prod
+  include: [env/prod-*.yaml]
+- name: local
+  host: localhost
+`)
+	write("env/dev.yaml", `
+- name: dev
+  host: dev.example.com
+`)
+	write("env/prod-db.yaml", `
+- name: db
+  host: db.example.com
+  user: root
+- name: cache
+  include: [cache/*.yaml]
+`)
+	write("env/cache/redis.yaml", `
+- name: redis
+  host: redis.example.com
+`)
+	write("config.d/personal.yaml", `
+- name: prod
+  children:
+    - name: db
+      host: db.example.com
+      user: me
+`)
+
+	pathname, nodes, err := LoadYamlConfigs(main)
+	ast.Nil(err)
+	ast.Equal(main, pathname)
+	ast.Len(nodes, 3)
+	ast.Equal("prod", nodes[0].Name)
+	ast.Equal("local", nodes[1].Name)
+	ast.Equal("dev", nodes[2].Name)
+	prod := nodes[0]
+	ast.Len(prod.Children, 2)
+	ast.Equal("me", prod.Children[0].User)
+	ast.Equal("redis", prod.Children[1].Children[0].Name)
+
+	// merge-ignore is for `sshw config merge`, loading keeps it
+	ignored := write("ignored.yaml", `
+- name: mine
+  host: mine.example.com
+  merge-ignore: true
+- name: prod
+  children:
+    - {name: tunnel, host: localhost, merge-ignore: true}
+`)
+	write("config.d/team.yaml", `
+- name: prod
+  children:
+    - {name: web, host: web.example.com}
+`)
+	_, nodes, err = LoadYamlConfigs(ignored)
+	ast.Nil(err)
+	ast.Len(nodes, 2)
+	ast.Equal("mine", nodes[0].Name)
+	ast.Equal([]string{"tunnel", "db", "web"}, []string{nodes[1].Children[0].Name, nodes[1].Children[1].Name, nodes[1].Children[2].Name})
+	_ = os.Remove(path.Join(dir, "config.d/team.yaml"))
+
+	// expanded nodes are layered one by one, personal prod is appended
+	pool := write("pool.yaml", `
+- name: web-${i}
+  host: web[1-3].example.com
+  user: deploy
+`)
+	write("config.d/pool.yaml", `
+- {name: web-2, host: web2.example.com, user: me}
+`)
+	_, nodes, err = LoadYamlConfigs(pool)
+	ast.Nil(err)
+	ast.Len(nodes, 4)
+	ast.Equal([]string{"web-1", "web-2", "web-3", "prod"}, []string{nodes[0].Name, nodes[1].Name, nodes[2].Name, nodes[3].Name})
+	ast.Equal([]string{"deploy", "me", "deploy"}, []string{nodes[0].User, nodes[1].User, nodes[2].User})
+	ast.Equal("web3.example.com", nodes[2].Host)
+	_ = os.Remove(path.Join(dir, "config.d/pool.yaml"))
+
+	write("env/prod-loop.yaml", `
+- name: loop
+  include: [../sshw.yaml]
+`)
+	_, _, err = LoadYamlConfigs(main)
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "include cycle")
+
+	_, _, err = LoadYamlConfigs(write("missing.yaml", "include: [nothing.yaml]\n"))
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "does not exist")
+}
@@ -0,0 +1,334 @@
+package sshwctl
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	InventoryExec = "exec"
+	InventoryHttp = "http"
+
+	defaultInventoryTTL     = 10 * time.Minute
+	defaultInventoryTimeout = 30 * time.Second
+)
+
+var InventoryCacheDir = path.Join(SshwDir, "inventory")
+
+// nodes from a command or http endpoint, they are merged into a bookmark
+// etc.
+// inventory:
+//   - name: cmdb
+//     type: http
+//     url: https://cmdb.example.com/api/hosts
+//     headers: {Authorization: "Bearer ${env:CMDB_TOKEN}"}
+//     items: data.hosts
+//     fields: {name: "${item:hostname}", host: "${item:ip}", tags: "${item:roles}"}
+type InventorySource struct {
+	// bookmark of nodes
+	Name string `yaml:"name"`
+	// exec or http
+	Type string `yaml:"type"`
+	// command prints nodes as json or yaml
+	Cmd string `yaml:"cmd,omitempty"`
+	// json endpoint, response should be 200
+	Url     string            `yaml:"url,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// path of list in output, etc. data.hosts, empty means output is the list
+	Items string `yaml:"items,omitempty"`
+	// node fields rendered with every item by ${item:path}
+	// if it is empty, output is a list of nodes
+	Fields map[string]string `yaml:"fields,omitempty"`
+	// output is cached, default is 10m
+	TTL time.Duration `yaml:"ttl,omitempty"`
+	// default is 30s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// bookmarks of inventories, stale cache is used if there is
+// failed source without cache is warned and skipped
+func LoadInventories(sources []*InventorySource) []*Node {
+	var bookmarks []*Node
+	for _, source := range sources {
+		nodes, err := source.Load()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "inventory %s: %v\n", source.Name, err)
+			continue
+		}
+		LayerNodes(&bookmarks, []*Node{{Name: source.Name, Children: nodes}})
+	}
+	return bookmarks
+}
+
+func (s *InventorySource) Load() ([]*Node, error) {
+	if s.Name == "" {
+		return nil, errors.New("name is empty")
+	}
+	out, err := s.cachedOutput()
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Fields) == 0 && s.Items == "" {
+		nodes, err := LoadYamlConfig0(out)
+		if err != nil {
+			return nil, err
+		}
+		markVerbatim(nodes, nil)
+		return nodes, nil
+	}
+	return s.mapItems(out)
+}
+
+func (s *InventorySource) ttl() time.Duration {
+	if s.TTL > 0 {
+		return s.TTL
+	}
+	return defaultInventoryTTL
+}
+
+func (s *InventorySource) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return defaultInventoryTimeout
+}
+
+func (s *InventorySource) cachePath() string {
+	sum := sha1.Sum([]byte(strings.Join([]string{s.Type, s.Cmd, s.Url}, "\x00")))
+	return path.Join(InventoryCacheDir, hex.EncodeToString(sum[:8]))
+}
+
+// output in cache if it is fresh, or fetch it. stale cache is used if fetching fails
+func (s *InventorySource) cachedOutput() ([]byte, error) {
+	cachePath := s.cachePath()
+	info, statErr := os.Stat(cachePath)
+	if statErr == nil && time.Since(info.ModTime()) < s.ttl() {
+		if b, err := ioutil.ReadFile(cachePath); err == nil {
+			return b, nil
+		}
+	}
+	out, err := s.fetch()
+	if err != nil {
+		if statErr == nil {
+			if b, readErr := ioutil.ReadFile(cachePath); readErr == nil {
+				_, _ = fmt.Fprintf(os.Stderr, "inventory %s: %v, use cache of %s\n", s.Name, err, info.ModTime().Format(time.RFC3339))
+				return b, nil
+			}
+		}
+		return nil, err
+	}
+	if err := os.MkdirAll(InventoryCacheDir, 0700); err == nil {
+		_ = ioutil.WriteFile(cachePath, out, 0600)
+	}
+	return out, nil
+}
+
+// templates of cmd, url and headers are rendered, etc. ${env:CMDB_TOKEN}
+func (s *InventorySource) fetch() ([]byte, error) {
+	switch s.Type {
+	case InventoryExec:
+		command, err := ParseSshwTemplate(s.Cmd).ExecuteContext(nil)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancelFunc := context.WithTimeout(context.Background(), s.timeout())
+		defer cancelFunc()
+		out := bytes.NewBuffer(nil)
+		cmd := shellCommand(command, nil)
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+		if err := runShellCommand(ctx, cmd); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, errors.Errorf("exec %s: timeout after %s", command, s.timeout())
+			}
+			return nil, errors.WithMessage(err, "exec "+command)
+		}
+		return out.Bytes(), nil
+	case InventoryHttp:
+		url, err := ParseSshwTemplate(s.Url).ExecuteContext(nil)
+		if err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Accept", "application/json")
+		for key, value := range s.Headers {
+			if value, err = ParseSshwTemplate(value).ExecuteContext(nil); err != nil {
+				return nil, errors.WithMessage(err, "header "+key)
+			}
+			request.Header.Set(key, value)
+		}
+		response, err := (&http.Client{Timeout: s.timeout()}).Do(request)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("get %s: %s", url, response.Status)
+		}
+		return ioutil.ReadAll(response.Body)
+	}
+	return nil, errors.Errorf("unknown type %s", s.Type)
+}
+
+// nodes of items, fields are rendered with every item
+func (s *InventorySource) mapItems(out []byte) ([]*Node, error) {
+	var output interface{}
+	if err := yamlv3.Unmarshal(out, &output); err != nil {
+		return nil, err
+	}
+	items, found := lookupItem(output, s.Items)
+	if !found {
+		return nil, errors.Errorf("items %s is not found", s.Items)
+	}
+	list, ok := items.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("items %s is not a list", s.Items)
+	}
+	if len(s.Fields) == 0 {
+		b, err := yamlv3.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := LoadYamlConfig0(b)
+		if err != nil {
+			return nil, err
+		}
+		markVerbatim(nodes, nil)
+		return nodes, nil
+	}
+
+	keys := make([]string, 0, len(s.Fields))
+	for key := range s.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var itemFields []string
+	for _, key := range keys {
+		if field, found := yamlField(nodeType.Elem(), key); found && strings.Contains(s.Fields[key], "${item:") {
+			itemFields = append(itemFields, field.Name)
+		}
+	}
+	doc := &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+	for i, item := range list {
+		ctx := &TemplateContext{item: item}
+		mapping := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		for _, key := range keys {
+			rendered, err := ParseSshwTemplate(s.Fields[key]).ExecuteContext(ctx)
+			if err != nil {
+				return nil, errors.WithMessage(err, "item "+strconv.Itoa(i)+": "+key)
+			}
+			value, err := nodeFieldValue(key, rendered)
+			if err != nil {
+				return nil, errors.WithMessage(err, "item "+strconv.Itoa(i))
+			}
+			if value != nil {
+				setMappingValue(mapping, key, value)
+			}
+		}
+		doc.Content = append(doc.Content, mapping)
+	}
+	b, err := yamlv3.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := LoadYamlConfig0(b)
+	if err != nil {
+		return nil, err
+	}
+	markVerbatim(nodes, itemFields)
+	return nodes, nil
+}
+
+// values of items are data, etc. ${exec:xxx} from a cmdb would run on connect if they were rendered
+// fields are never rendered, without names, every string field of nodes and their children and jumps
+func markVerbatim(nodes []*Node, names []string) {
+	for _, node := range nodes {
+		node.Verbatim = make(map[string]bool)
+		for _, name := range names {
+			node.Verbatim[name] = true
+		}
+		if names == nil {
+			v := reflect.ValueOf(node).Elem()
+			for i := 0; i < v.NumField(); i++ {
+				field := v.Type().Field(i)
+				if field.Tag.Get("yaml") == "-" || v.Field(i).IsZero() {
+					continue
+				}
+				if t := field.Type; t.Kind() == reflect.String || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String) {
+					node.Verbatim[field.Name] = true
+				}
+			}
+			markVerbatim(node.Children, nil)
+			markVerbatim(node.Jump, nil)
+		}
+	}
+}
+
+// value of path separated by dot, index of list is number, etc. data.hosts.0.ip
+func lookupItem(v interface{}, p string) (interface{}, bool) {
+	if p == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(p, ".") {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			child, has := value[key]
+			if !has {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			v = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// field of inventory item, list is joined by comma
+func itemSource(ctx *TemplateContext, expr string) (string, error) {
+	if ctx == nil || ctx.item == nil {
+		return "", errors.New("no inventory item")
+	}
+	p := strings.TrimSpace(expr)
+	v, found := lookupItem(ctx.item, p)
+	if !found {
+		return "", errors.Errorf("item has no %s", p)
+	}
+	switch value := v.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", errors.Errorf("item %s is not scalar", p)
+	}
+	return fmt.Sprint(v), nil
+}
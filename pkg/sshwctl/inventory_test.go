@@ -0,0 +1,122 @@
+package sshwctl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventorySource_Load(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	cacheDir := InventoryCacheDir
+	InventoryCacheDir = path.Join(dir, "inventory")
+	defer func() {
+		InventoryCacheDir = cacheDir
+	}()
+
+	// exec prints nodes, output is cached
+	counter := path.Join(dir, "counter")
+	source := &InventorySource{Name: "cmdb", Type: InventoryExec,
+		Cmd: `echo >> ` + counter + `; echo '[{"name": "web", "host": "10.0.0.1", "port": 2222}]'`}
+	for i := 0; i < 2; i++ {
+		nodes, err := source.Load()
+		ast.Nil(err)
+		ast.Len(nodes, 1)
+		ast.Equal("10.0.0.1", nodes[0].Host)
+		ast.Equal(2222, nodes[0].Port)
+	}
+	b, _ := ioutil.ReadFile(counter)
+	ast.Equal("\n", string(b))
+
+	// http items are mapped by fields
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {"hosts": [
+			{"hostname": "DB-1", "ip": "10.0.1.1", "ssh": {"port": 22}, "roles": ["db", "prod"]},
+			{"hostname": "DB-2", "ip": "10.0.1.2", "ssh": {"port": 2200}, "roles": []}
+		]}}`))
+	}))
+	defer server.Close()
+	_ = os.Setenv("SSHW_TEST_CMDB_TOKEN", "token")
+	defer os.Unsetenv("SSHW_TEST_CMDB_TOKEN")
+	source = &InventorySource{Name: "cmdb", Type: InventoryHttp, Url: server.URL,
+		Headers: map[string]string{"Authorization": "Bearer ${env:SSHW_TEST_CMDB_TOKEN}"},
+		Items:   "data.hosts",
+		Fields:  map[string]string{"name": "${item:hostname | lower}", "host": "${item:ip}", "port": "${item:ssh.port}", "tags": "${item:roles}"},
+	}
+	nodes, err := source.Load()
+	ast.Nil(err)
+	ast.Len(nodes, 2)
+	verbatim := map[string]bool{"Name": true, "Host": true, "Port": true, "Tags": true}
+	ast.Equal(&Node{Name: "db-1", Host: "10.0.1.1", Port: 22, Tags: []string{"db", "prod"}, Verbatim: verbatim}, nodes[0])
+	ast.Equal(&Node{Name: "db-2", Host: "10.0.1.2", Port: 2200, Verbatim: verbatim}, nodes[1])
+
+	// stale cache is used if fetching fails
+	source.TTL = 1
+	source.Headers = nil
+	nodes, err = source.Load()
+	ast.Nil(err)
+	ast.Len(nodes, 2)
+
+	source.Url = server.URL + "/missing"
+	_, err = source.Load()
+	ast.NotNil(err)
+	ast.True(strings.Contains(err.Error(), "401"))
+
+	bookmarks := LoadInventories([]*InventorySource{{Name: "cmdb", Type: InventoryExec, Cmd: `echo '[{"name": "web", "host": "h"}]'`}})
+	ast.Len(bookmarks, 1)
+	ast.Equal("cmdb", bookmarks[0].Name)
+	ast.Equal("web", bookmarks[0].Children[0].Name)
+
+	// failed source without cache is skipped
+	bookmarks = LoadInventories([]*InventorySource{{Name: "broken", Type: InventoryExec, Cmd: "exit 1"}})
+	ast.Empty(bookmarks)
+
+	// children of command are killed on timeout
+	start := time.Now()
+	_, err = (&InventorySource{Name: "slow", Type: InventoryExec, Cmd: "sleep 5; echo []", Timeout: 100 * time.Millisecond}).Load()
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "timeout")
+	ast.True(time.Since(start) < 2*time.Second)
+}
+
+func TestInventorySource_Verbatim(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	cacheDir := InventoryCacheDir
+	InventoryCacheDir = path.Join(dir, "inventory")
+	defer func() {
+		InventoryCacheDir = cacheDir
+	}()
+
+	// templates in values of items are data, they never run
+	injected := path.Join(dir, "injected")
+	out := path.Join(dir, "out.json")
+	ast.Nil(ioutil.WriteFile(out, []byte(`[{"name": "web", "host": "10.0.0.1", "user": "${exec:touch `+injected+`}"}]`), 0600))
+	for _, source := range []*InventorySource{
+		{Name: "raw", Type: InventoryExec, Cmd: "cat " + out},
+		{Name: "fields", Type: InventoryExec, Cmd: "cat " + out,
+			Fields: map[string]string{"name": "${item:name}", "user": "${item:user}", "password": "${exec:echo secret}"}},
+	} {
+		nodes, err := source.Load()
+		ast.Nil(err, source.Name)
+		ast.Nil(InitNodes(nodes))
+		ast.Nil(ResolveNode(nodes[0]))
+		ast.Equal("${exec:touch "+injected+"}", nodes[0].User, source.Name)
+		_, err = os.Stat(injected)
+		ast.True(os.IsNotExist(err), source.Name)
+	}
+}
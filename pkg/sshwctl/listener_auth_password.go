@@ -1,13 +1,9 @@
 package sshwctl
 
 import (
-	"bufio"
 	"fmt"
-	"github.com/dgryski/dgoogauth"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/terminal"
 	"strings"
-	"time"
 )
 
 func init() {
@@ -22,48 +18,58 @@ func AuthPwdPostInitClientConfig(ctx *EventContext, clientConfig *ssh.ClientConf
 
 	if password != nil {
 		clientConfig.Auth = append(clientConfig.Auth, password)
+	} else if node.CredentialHelper != "" {
+		clientConfig.Auth = append(clientConfig.Auth, ssh.PasswordCallback(func() (string, error) {
+			credential := &Credential{Kind: CredentialPassword}
+			return askCredential(ctx, credential, fmt.Sprintf("%s@%s's password:", node.user(), node.Host), false)
+		}))
 	}
 
 	clientConfig.Auth = append(clientConfig.Auth, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
 		answers := make([]string, 0, len(questions))
 	QUESTIONS:
 		for i, q := range questions {
-			node.Print(q)
 			for interactIndex := range node.KeyboardInteractions {
 				keyboardInteractive := node.KeyboardInteractions[interactIndex]
 				if strings.Contains(q, keyboardInteractive.Question) {
 					answer := keyboardInteractive.Answer
+					// ask credential helper, and prompt user if helper does not know it
+					if answer == "" && node.CredentialHelper != "" {
+						if keyboardInteractive.GoogleAuth {
+							credential := &Credential{Kind: CredentialOtp, Question: keyboardInteractive.Question}
+							if !lookupCredential(ctx, credential) {
+								break
+							}
+							answer = credential.Secret
+						} else {
+							credential := &Credential{Kind: CredentialKeyboardInteractive, Question: keyboardInteractive.Question}
+							secret, err := askCredential(ctx, credential, q, echos[i])
+							if err != nil {
+								return nil, err
+							}
+							answers = append(answers, secret)
+							continue QUESTIONS
+						}
+					}
+					node.Print(q)
 					if keyboardInteractive.GoogleAuth {
-						answer = googauthCodeStr(keyboardInteractive.Answer)
+						code, err := OtpCode(answer)
+						if err != nil {
+							return nil, err
+						}
+						answer = code
 						node.Print(answer)
 					}
 					answers = append(answers, answer)
 					continue QUESTIONS
 				}
 			}
-			if echos[i] {
-				scan := bufio.NewScanner(node.stdin())
-				if scan.Scan() {
-					answers = append(answers, scan.Text())
-				}
-				if err := scan.Err(); err != nil {
-					return nil, err
-				}
-			} else {
-				// todo fd
-				b, err := terminal.ReadPassword(0)
-				if err != nil {
-					return nil, err
-				}
-				node.Println("")
-				answers = append(answers, string(b))
+			answer, err := NewPrompter(node).Prompt(q, echos[i])
+			if err != nil {
+				return nil, err
 			}
+			answers = append(answers, answer)
 		}
 		return answers, nil
 	}))
 }
-
-func googauthCodeStr(secret string) string {
-	code := dgoogauth.ComputeCode(secret, time.Now().Unix()/30)
-	return fmt.Sprintf("%06d", code)
-}
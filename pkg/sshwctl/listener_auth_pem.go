@@ -10,15 +10,21 @@ func init() {
 	_ = bus.Subscribe(PostInitClientConfig, AuthPemPostInitClientConfig)
 }
 
+// KeyPath or ~/.ssh/id_rsa, and then IdentityFiles
 func AuthPemPostInitClientConfig(ctx *EventContext, clientConfig *ssh.ClientConfig) {
 	node := ctx.Node
-	var pemBytes []byte
-	var err error
-	if node.KeyPath == "" {
-		pemBytes, err = ioutil.ReadFile(userIdRsa)
-	} else {
-		pemBytes, err = ioutil.ReadFile(node.KeyPath)
+	keyPath := node.KeyPath
+	if keyPath == "" {
+		keyPath = userIdRsa
+	}
+	for _, p := range append([]string{keyPath}, node.IdentityFiles...) {
+		authPem(ctx, clientConfig, p)
 	}
+}
+
+func authPem(ctx *EventContext, clientConfig *ssh.ClientConfig, keyPath string) {
+	node := ctx.Node
+	pemBytes, err := ioutil.ReadFile(keyPath)
 	if err != nil {
 		fmt.Println(err)
 	} else {
@@ -28,10 +34,62 @@ func AuthPemPostInitClientConfig(ctx *EventContext, clientConfig *ssh.ClientConf
 		} else {
 			signer, err = ssh.ParsePrivateKey(pemBytes)
 		}
-		if err != nil {
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			// ask passphrase only when server accepts publickey
+			clientConfig.Auth = append(clientConfig.Auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				return promptPassphrase(ctx, keyPath, pemBytes)
+			}))
+		} else if err != nil {
 			fmt.Println(err)
 		} else {
-			clientConfig.Auth = append(clientConfig.Auth, ssh.PublicKeys(signer))
+			clientConfig.Auth = append(clientConfig.Auth, ssh.PublicKeys(withCertificate(node, signer)...))
 		}
 	}
 }
+
+// ask credential helper or prompt, if it fails, skip the key rather than abort auth
+func promptPassphrase(ctx *EventContext, keyPath string, pemBytes []byte) ([]ssh.Signer, error) {
+	node := ctx.Node
+	credential := &Credential{Kind: CredentialPassphrase, Path: keyPath}
+	passphrase, err := askCredential(ctx, credential, fmt.Sprintf("Enter passphrase for key '%s':", keyPath), false)
+	if err != nil {
+		node.Error(err)
+		return nil, nil
+	}
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	if err != nil {
+		node.Error(err)
+		// wrong passphrase would not be stored
+		forgetCredential(ctx, credential)
+		return nil, nil
+	}
+	return withCertificate(node, signer), nil
+}
+
+// certificate signer goes first if node has CertificateFile
+func withCertificate(node *Node, signer ssh.Signer) []ssh.Signer {
+	if node.CertificateFile == "" {
+		return []ssh.Signer{signer}
+	}
+	b, err := ioutil.ReadFile(node.CertificateFile)
+	if err != nil {
+		node.Error(err)
+		return []ssh.Signer{signer}
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		node.Error(err)
+		return []ssh.Signer{signer}
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		node.Error(fmt.Errorf("%s is not a certificate", node.CertificateFile))
+		return []ssh.Signer{signer}
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		node.Error(err)
+		return []ssh.Signer{signer}
+	}
+	return []ssh.Signer{certSigner, signer}
+}
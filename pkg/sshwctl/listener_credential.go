@@ -0,0 +1,100 @@
+package sshwctl
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	KeyCredentials = "credentials"
+)
+
+func init() {
+	_ = bus.Subscribe(PostSSHDial, CredentialPostSSHDial)
+	_ = bus.Subscribe(OnAuthFailure, CredentialOnAuthFailure)
+}
+
+// ask credential helper of node, return false if helper is not set or does not know it
+// credential is remembered to store or erase after auth
+func lookupCredential(ctx *EventContext, credential *Credential) bool {
+	node := ctx.Node
+	if node.CredentialHelper == "" {
+		return false
+	}
+	credential.Host = node.Host
+	credential.Port = node.port()
+	credential.User = node.user()
+	has, err := NewCredentialHelper(node.CredentialHelper).Get(credential)
+	if err != nil {
+		node.Error(err)
+		return false
+	}
+	if has {
+		rememberCredential(ctx, credential)
+	}
+	return has
+}
+
+// ask credential helper first, and then prompt user
+func askCredential(ctx *EventContext, credential *Credential, question string, echo bool) (string, error) {
+	if lookupCredential(ctx, credential) {
+		return credential.Secret, nil
+	}
+	secret, err := NewPrompter(ctx.Node).Prompt(question, echo)
+	if err != nil {
+		return "", err
+	}
+	if ctx.Node.CredentialHelper != "" {
+		credential.Secret = secret
+		rememberCredential(ctx, credential)
+	}
+	return secret, nil
+}
+
+func rememberCredential(ctx *EventContext, credential *Credential) {
+	credentials, _ := ctx.Get(KeyCredentials)
+	list, _ := credentials.([]*Credential)
+	ctx.Put(KeyCredentials, append(list, credential))
+}
+
+// erase credential from helper, and do not store it after auth
+func forgetCredential(ctx *EventContext, credential *Credential) {
+	node := ctx.Node
+	list := rememberedCredentials(ctx)
+	for i := range list {
+		if list[i] == credential {
+			ctx.Put(KeyCredentials, append(list[:i:i], list[i+1:]...))
+			if err := NewCredentialHelper(node.CredentialHelper).Erase(credential); err != nil {
+				node.Error(err)
+			}
+			return
+		}
+	}
+}
+
+func rememberedCredentials(ctx *EventContext) []*Credential {
+	credentials, _ := ctx.Get(KeyCredentials)
+	list, _ := credentials.([]*Credential)
+	return list
+}
+
+// auth success, store credentials
+func CredentialPostSSHDial(ctx *EventContext, client *ssh.Client) {
+	node := ctx.Node
+	for _, credential := range rememberedCredentials(ctx) {
+		if err := NewCredentialHelper(node.CredentialHelper).Store(credential); err != nil {
+			node.Error(err)
+		}
+	}
+	ctx.Put(KeyCredentials, nil)
+}
+
+// auth failure, erase credentials
+func CredentialOnAuthFailure(ctx *EventContext, err error) {
+	node := ctx.Node
+	for _, credential := range rememberedCredentials(ctx) {
+		if err := NewCredentialHelper(node.CredentialHelper).Erase(credential); err != nil {
+			node.Error(err)
+		}
+	}
+	ctx.Put(KeyCredentials, nil)
+}
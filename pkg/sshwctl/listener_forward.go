@@ -0,0 +1,31 @@
+package sshwctl
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+func init() {
+	_ = bus.Subscribe(PostSSHDial, ForwardPostSSHDial)
+}
+
+// forward failure is printed, it does not interrupt session like ssh
+func ForwardPostSSHDial(ctx *EventContext, client *ssh.Client) {
+	node := ctx.Node
+	start := func(specs []string, local bool) {
+		for _, spec := range specs {
+			forward, err := ParseForward(spec)
+			if err == nil {
+				if local {
+					_, err = forward.StartLocal(client)
+				} else {
+					_, err = forward.StartRemote(client)
+				}
+			}
+			if err != nil {
+				node.Error(err)
+			}
+		}
+	}
+	start(node.LocalForward, true)
+	start(node.RemoteForward, false)
+}
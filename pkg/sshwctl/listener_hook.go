@@ -0,0 +1,122 @@
+package sshwctl
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// connection is pooled by daemon, see NewPooledClient
+	KeyPooled = "pooled"
+)
+
+func init() {
+	_ = bus.Subscribe(PostSSHDial, HookPostSSHDial)
+	_ = bus.Subscribe(OnAuthFailure, HookOnAuthFailure)
+	_ = bus.Subscribe(PostSessionEnd, HookPostSessionEnd)
+	_ = bus.Subscribe(PostClose, HookPostClose)
+}
+
+// result of a shell session
+type SessionEnd struct {
+	// exit status of remote shell, 255 if it is unknown
+	ExitStatus int
+	Duration   time.Duration
+	Err        error
+}
+
+func NewSessionEnd(start time.Time, err error) *SessionEnd {
+	sessionEnd := &SessionEnd{
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if err != nil {
+		sessionEnd.ExitStatus = 255
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			sessionEnd.ExitStatus = exitErr.ExitStatus()
+		}
+	}
+	return sessionEnd
+}
+
+// x/crypto/ssh has no type of auth failure, it returns fmt.Errorf("ssh: unable to authenticate, ...")
+// wrapped by "ssh: handshake failed", so the message is matched
+func IsAuthFailure(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// environment variables of hooks, execs-pre and execs-stop
+func hookEnv(node *Node, event string, extra ...string) []string {
+	env := []string{
+		"SSHW_EVENT=" + event,
+		"SSHW_NODE_NAME=" + node.Name,
+		"SSHW_NODE_ALIAS=" + node.Alias,
+		"SSHW_HOST=" + node.Host,
+		"SSHW_PORT=" + node.portStr(),
+		"SSHW_USER=" + node.user(),
+	}
+	return append(env, extra...)
+}
+
+func durationEnv(d time.Duration) string {
+	return "SSHW_DURATION=" + strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// hook would not read stdin of user
+// error of hook is printed, it does not interrupt session
+func runHook(node *Node, hooks []*NodeExec, env []string) {
+	if len(hooks) == 0 {
+		return
+	}
+	if _, err := execs(hooks, nil, node.stdout(), env...); err != nil {
+		node.Error(err)
+	}
+}
+
+// daemon runs on-connect and on-disconnect for every session, see RunConnectionHooks
+func isPooled(ctx *EventContext) bool {
+	_, pooled := ctx.Get(KeyPooled)
+	return pooled
+}
+
+// run on-connect before f and on-disconnect after f, SSHW_DURATION is duration of f
+// daemon shares a pooled connection between sessions, it runs hooks for every session by this
+func RunConnectionHooks(node *Node, f func() error) error {
+	start := time.Now()
+	runHook(node, node.OnConnect, hookEnv(node, "on-connect"))
+	err := f()
+	runHook(node, node.OnDisconnect, hookEnv(node, "on-disconnect", durationEnv(time.Since(start))))
+	return err
+}
+
+func HookPostSSHDial(ctx *EventContext, client *ssh.Client) {
+	if isPooled(ctx) {
+		return
+	}
+	node := ctx.Node
+	runHook(node, node.OnConnect, hookEnv(node, "on-connect"))
+}
+
+func HookOnAuthFailure(ctx *EventContext, err error) {
+	node := ctx.Node
+	runHook(node, node.OnAuthFailure, hookEnv(node, "on-auth-failure", "SSHW_ERROR="+err.Error()))
+}
+
+func HookPostSessionEnd(ctx *EventContext, sessionEnd *SessionEnd) {
+	node := ctx.Node
+	runHook(node, node.OnSessionEnd, hookEnv(node, "on-session-end",
+		"SSHW_EXIT_STATUS="+strconv.Itoa(sessionEnd.ExitStatus),
+		durationEnv(sessionEnd.Duration),
+	))
+}
+
+func HookPostClose(ctx *EventContext, duration time.Duration) {
+	if isPooled(ctx) {
+		return
+	}
+	node := ctx.Node
+	runHook(node, node.OnDisconnect, hookEnv(node, "on-disconnect", durationEnv(duration)))
+}
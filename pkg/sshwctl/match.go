@@ -0,0 +1,185 @@
+package sshwctl
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	// global entries are applied in order of config, fields of former entry win
+	GlobalMatchFirst = "first"
+	// global entries are applied from the most specific one
+	GlobalMatchSpecific = "specific"
+)
+
+// match host like ssh_config, patterns are split by comma or space
+// `*` matches any characters, `?` matches one character, `!` negates pattern
+// host matches if it matches any pattern and does not match any negated one
+func MatchHostPatterns(host, patterns string) bool {
+	matched := false
+	for _, pattern := range splitPatterns(patterns) {
+		if strings.HasPrefix(pattern, "!") {
+			if matchWildcard(strings.ToLower(pattern[1:]), strings.ToLower(host)) {
+				return false
+			}
+			continue
+		}
+		if matchWildcard(strings.ToLower(pattern), strings.ToLower(host)) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func splitPatterns(patterns string) []string {
+	return strings.FieldsFunc(patterns, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) != 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// host matches if it is an ip in any cidr, return longest prefix of matched cidr
+func matchCidr(host, cidrs string) (int, bool) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return 0, false
+	}
+	longest, matched := 0, false
+	for _, cidr := range splitPatterns(cidrs) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil || !ipNet.Contains(ip) {
+			continue
+		}
+		ones, _ := ipNet.Mask.Size()
+		if !matched || ones > longest {
+			longest = ones
+		}
+		matched = true
+	}
+	return longest, matched
+}
+
+// node has every tag
+func hasTags(node *Node, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, nodeTag := range node.Tags {
+			if nodeTag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// global entry matches node
+// host is exact match, host-pattern, cidr and match-tags must all match if they are set
+func matchGlobalNode(node, globalNode *Node, hosts ...string) bool {
+	if globalNode.HostPattern == "" && globalNode.Cidr == "" && len(globalNode.MatchTags) == 0 {
+		for _, host := range hosts {
+			if host == globalNode.Host {
+				return true
+			}
+		}
+		return false
+	}
+	if globalNode.Host != "" {
+		exact := false
+		for _, host := range hosts {
+			exact = exact || host == globalNode.Host
+		}
+		if !exact {
+			return false
+		}
+	}
+	if globalNode.HostPattern != "" {
+		matched := false
+		for _, host := range hosts {
+			matched = matched || (host != "" && MatchHostPatterns(host, globalNode.HostPattern))
+		}
+		if !matched {
+			return false
+		}
+	}
+	if globalNode.Cidr != "" {
+		if _, matched := matchCidr(node.Host, globalNode.Cidr); !matched {
+			return false
+		}
+	}
+	if len(globalNode.MatchTags) != 0 && !hasTags(node, globalNode.MatchTags) {
+		return false
+	}
+	return true
+}
+
+// specificity of a matched global entry, higher is more specific
+// only criteria of the entry are scored, they are all matched by match func
+func globalNodeSpecificity(node, globalNode *Node) int {
+	score := 0
+	if globalNode.Host != "" {
+		score += 1000
+	}
+	if globalNode.HostPattern != "" {
+		// literal characters of pattern
+		score += 100 + len(strings.NewReplacer("*", "", "?", "").Replace(globalNode.HostPattern))
+	}
+	if globalNode.Cidr != "" {
+		ones, _ := matchCidr(node.Host, globalNode.Cidr)
+		score += 100 + ones
+	}
+	score += 10 * len(globalNode.MatchTags)
+	return score
+}
+
+// matched global entries in order of precedence
+func matchedGlobalNodes(node *Node, matchFunc MatchFunc) []*Node {
+	type scored struct {
+		node  *Node
+		score int
+	}
+	var matched []scored
+	for si := range globalConfig {
+		globalNode := globalConfig[si]
+		if matchFunc(node, globalNode) {
+			matched = append(matched, scored{node: globalNode, score: globalNodeSpecificity(node, globalNode)})
+		}
+	}
+	if globalSettings.GlobalMatch == GlobalMatchSpecific {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].score > matched[j].score
+		})
+	}
+	nodes := make([]*Node, len(matched))
+	for i := range matched {
+		nodes[i] = matched[i].node
+	}
+	return nodes
+}
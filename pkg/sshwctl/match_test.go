@@ -0,0 +1,68 @@
+package sshwctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchHostPatterns(t *testing.T) {
+	ast := assert.New(t)
+	tests := []struct {
+		host     string
+		patterns string
+		want     bool
+	}{
+		{"web.prod.example.com", "*.prod.example.com", true},
+		{"WEB.prod.example.com", "*.prod.example.com", true},
+		{"db.prod.example.com", "*.prod.example.com,!db.prod.example.com", false},
+		{"db.prod.example.com", "!db.* *.example.com", false},
+		{"web1", "web?", true},
+		{"web12", "web?", false},
+		{"web.dev.example.com", "*.prod.example.com", false},
+		{"host", "!other", false},
+	}
+	for _, tt := range tests {
+		ast.Equal(tt.want, MatchHostPatterns(tt.host, tt.patterns), tt.host+" "+tt.patterns)
+	}
+}
+
+func TestInitNodesBaseOnGlobalMatch(t *testing.T) {
+	ast := assert.New(t)
+	config, settings := globalConfig, globalSettings
+	defer func() {
+		globalConfig, globalSettings = config, settings
+	}()
+	globalConfig = []*Node{
+		{Name: "network", Cidr: "10.20.0.0/16", User: "network", KeyPath: "~/.ssh/network"},
+		{Name: "subnet", Cidr: "10.20.1.0/24", User: "subnet"},
+		{Name: "prod", HostPattern: "*.prod.example.com,!db.prod.example.com", Jump: []*Node{{Host: "bastion"}}},
+		{Name: "db", MatchTags: []string{"db"}, User: "dba"},
+	}
+	globalSettings = &Settings{}
+
+	nodes := []*Node{
+		{Name: "a", Host: "10.20.1.3"},
+		{Name: "b", Host: "web.prod.example.com"},
+		{Name: "c", Host: "db.prod.example.com", Tags: []string{"db"}},
+		{Name: "d", Host: "10.30.1.3"},
+	}
+	InitNodesBaseOnGlobal(nodes, MatchCommonConfig)
+	ast.Equal("network", nodes[0].User)
+	ast.Equal("~/.ssh/network", nodes[0].KeyPath)
+	ast.Equal("bastion", nodes[1].Jump[0].Host)
+	ast.Len(nodes[2].Jump, 0)
+	ast.Equal("dba", nodes[2].User)
+	ast.Equal("", nodes[3].User)
+
+	globalSettings = &Settings{GlobalMatch: GlobalMatchSpecific}
+	specific := &Node{Name: "a", Host: "10.20.1.3"}
+	InitNodesBaseOnGlobal([]*Node{specific}, MatchCommonConfig)
+	ast.Equal("subnet", specific.User)
+	ast.Equal("~/.ssh/network", specific.KeyPath)
+
+	// only criteria of entries are scored, etc. name of node is not a host of common config
+	ast.Equal(116, globalNodeSpecificity(specific, &Node{HostPattern: "10.20.*", MatchTags: []string{"db"}}))
+	ast.Equal(124, globalNodeSpecificity(specific, globalConfig[1]))
+	ast.Equal(1000, globalNodeSpecificity(specific, &Node{Host: "10.20.1.3"}))
+}
@@ -0,0 +1,202 @@
+package sshwctl
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	OtpTypeTotp = "totp"
+	OtpTypeHotp = "hotp"
+)
+
+var (
+	// { [fingerprint of secret]: [next counter] }
+	OtpCounterPath = path.Join(SshwDir, "hotp-counters.yaml")
+	otpCounterLock sync.Mutex
+)
+
+// one-time password
+// secret is base32 secret of google authenticator or otpauth uri
+// etc. otpauth://totp/bastion:dev?secret=JBSWY3DPEHPK3PXP&algorithm=SHA256&digits=8&period=60
+// etc. otpauth://hotp/bastion:dev?secret=JBSWY3DPEHPK3PXP&counter=10
+type Otp struct {
+	Type      string
+	Label     string
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	// seconds, only totp
+	Period int64
+	// initial counter, only hotp
+	Counter uint64
+}
+
+func ParseOtp(secret string) (*Otp, error) {
+	otp := &Otp{
+		Type:      OtpTypeTotp,
+		Algorithm: "SHA1",
+		Digits:    6,
+		Period:    30,
+	}
+	if !strings.HasPrefix(secret, "otpauth://") {
+		key, err := decodeOtpSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		otp.Secret = key
+		return otp, nil
+	}
+
+	uri, err := url.Parse(secret)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse otpauth")
+	}
+	otp.Type = strings.ToLower(uri.Host)
+	if otp.Type != OtpTypeTotp && otp.Type != OtpTypeHotp {
+		return nil, errors.Errorf("unsupported otp type %s", uri.Host)
+	}
+	otp.Label = strings.TrimPrefix(uri.Path, "/")
+	query := uri.Query()
+	if otp.Secret, err = decodeOtpSecret(query.Get("secret")); err != nil {
+		return nil, err
+	}
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		otp.Algorithm = strings.ToUpper(algorithm)
+		if _, err := otp.hash(); err != nil {
+			return nil, err
+		}
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if otp.Digits, err = strconv.Atoi(digits); err != nil || otp.Digits < 6 || otp.Digits > 10 {
+			return nil, errors.Errorf("invalid otp digits %s", digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		if otp.Period, err = strconv.ParseInt(period, 10, 64); err != nil || otp.Period <= 0 {
+			return nil, errors.Errorf("invalid otp period %s", period)
+		}
+	}
+	if counter := query.Get("counter"); counter != "" {
+		if otp.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return nil, errors.Errorf("invalid otp counter %s", counter)
+		}
+	} else if otp.Type == OtpTypeHotp {
+		return nil, errors.New("hotp needs counter")
+	}
+	return otp, nil
+}
+
+func decodeOtpSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return nil, errors.New("otp secret is empty")
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, errors.WithMessage(err, "decode otp secret")
+	}
+	return key, nil
+}
+
+func (o *Otp) hash() (func() hash.Hash, error) {
+	switch o.Algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, errors.Errorf("unsupported otp algorithm %s", o.Algorithm)
+}
+
+// rfc4226
+func (o *Otp) compute(counter uint64) (string, error) {
+	h, err := o.hash()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(h, o.Secret)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	_, _ = mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint64(1)
+	for i := 0; i < o.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", o.Digits, uint64(truncated)%mod), nil
+}
+
+// totp uses time, hotp uses and increases counter persisted in OtpCounterPath
+func (o *Otp) Code(t time.Time) (string, error) {
+	if o.Type == OtpTypeTotp {
+		return o.compute(uint64(t.Unix() / o.Period))
+	}
+	otpCounterLock.Lock()
+	defer otpCounterLock.Unlock()
+	counters := make(map[string]uint64)
+	if b, err := ioutil.ReadFile(OtpCounterPath); err == nil {
+		if err := yaml.Unmarshal(b, &counters); err != nil {
+			return "", errors.WithMessage(err, "read hotp counter")
+		}
+	}
+	fingerprint := o.fingerprint()
+	counter := o.Counter
+	if stored := counters[fingerprint]; stored > counter {
+		counter = stored
+	}
+	code, err := o.compute(counter)
+	if err != nil {
+		return "", err
+	}
+	counters[fingerprint] = counter + 1
+	b, err := yaml.Marshal(counters)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(path.Dir(OtpCounterPath), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(OtpCounterPath, b, 0600); err != nil {
+		return "", errors.WithMessage(err, "write hotp counter")
+	}
+	return code, nil
+}
+
+// key of counter, do not persist secret
+func (o *Otp) fingerprint() string {
+	sum := sha256.Sum256(append([]byte(o.Label+":"), o.Secret...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// current code of secret
+func OtpCode(secret string) (string, error) {
+	otp, err := ParseOtp(secret)
+	if err != nil {
+		return "", err
+	}
+	return otp.Code(time.Now())
+}
@@ -0,0 +1,84 @@
+package sshwctl
+
+import (
+	"encoding/base32"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc6238 appendix B
+func TestOtpCode(t *testing.T) {
+	encode := func(s string) string {
+		return base32.StdEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		name   string
+		secret string
+		want   string
+	}{
+		{
+			name:   "sha1",
+			secret: "otpauth://totp/test?digits=8&secret=" + encode("12345678901234567890"),
+			want:   "94287082",
+		},
+		{
+			name:   "sha256",
+			secret: "otpauth://totp/test?digits=8&algorithm=SHA256&secret=" + encode("12345678901234567890123456789012"),
+			want:   "46119246",
+		},
+		{
+			name:   "sha512",
+			secret: "otpauth://totp/test?digits=8&algorithm=SHA512&secret=" + encode("1234567890123456789012345678901234567890123456789012345678901234"),
+			want:   "90693936",
+		},
+		{
+			name:   "period",
+			secret: "otpauth://totp/test?digits=8&period=60&secret=" + encode("12345678901234567890"),
+			want:   "84755224",
+		},
+		{
+			name:   "google",
+			secret: encode("12345678901234567890"),
+			want:   "287082",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			otp, err := ParseOtp(tt.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := otp.Code(time.Unix(59, 0)); got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// rfc4226 appendix D
+func TestOtpHotpCounter(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	defer func(origin string) {
+		OtpCounterPath = origin
+	}(OtpCounterPath)
+	OtpCounterPath = path.Join(dir, "hotp-counters.yaml")
+
+	secret := "otpauth://hotp/test?counter=0&secret=" + base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for _, want := range []string{"755224", "287082", "359152"} {
+		code, err := OtpCode(secret)
+		ast.Nil(err)
+		ast.Equal(want, code)
+	}
+
+	_, err := ParseOtp("otpauth://hotp/test?secret=GEZDGNBV")
+	ast.NotNil(err)
+	_, err = ParseOtp("otpauth://totp/test?secret=GEZDGNBV&algorithm=MD5")
+	ast.NotNil(err)
+}
@@ -0,0 +1,359 @@
+package sshwctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// Plugin is an executable listed in global config, etc.
+//
+//  plugins:
+//    - name: audit
+//      cmd: /usr/local/bin/sshw-audit --verbose
+//
+// sshw talks to plugin by JSON-RPC 2.0, one message per line in stdin and stdout of plugin.
+// First sshw calls `initialize`, plugin answers the events it subscribes, etc. {"events": ["OnStdout"]}.
+// Then sshw calls method named by event with PluginParams, plugin answers PluginResult.
+// Stderr of plugin is stderr of sshw.
+type PluginConfig struct {
+	Name string `yaml:"name"`
+	// run by shell
+	Cmd string `yaml:"cmd"`
+	// timeout of each call, default is 5s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+const (
+	PluginMethodInitialize = "initialize"
+	defaultPluginTimeout   = 5 * time.Second
+)
+
+// node without secrets
+type PluginNode struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias,omitempty"`
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+	User  string `json:"user"`
+}
+
+type PluginParams struct {
+	Node *PluginNode `json:"node"`
+	// OnStdout, OnStderr
+	Data string `json:"data,omitempty"`
+	// PostSSHDial
+	ServerVersion string `json:"server_version,omitempty"`
+	// PostSessionEnd
+	ExitStatus int `json:"exit_status,omitempty"`
+	// PostSessionEnd, PostClose, seconds
+	Duration int64 `json:"duration,omitempty"`
+	// OnAuthFailure
+	Error string `json:"error,omitempty"`
+}
+
+// change behavior of sshw
+type PluginResult struct {
+	// interrupt current phase
+	Error string `json:"error,omitempty"`
+	// print to user
+	Message string `json:"message,omitempty"`
+	// PostInitClientConfig, replace user
+	User string `json:"user,omitempty"`
+	// PostInitClientConfig, add password auth
+	Password string `json:"password,omitempty"`
+	// PostShell, write into stdin of remote shell
+	Input string `json:"input,omitempty"`
+}
+
+type PluginInitializeResult struct {
+	Events []string `json:"events"`
+}
+
+type pluginRequest struct {
+	Version string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type pluginResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type Plugin struct {
+	Config *PluginConfig
+	Events []string
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte
+	done  chan struct{}
+
+	mutex sync.Mutex
+	id    int64
+	dead  bool
+}
+
+// start plugin process and initialize it
+func StartPlugin(config *PluginConfig) (*Plugin, error) {
+	cmd := exec.Command(Shell(), "-c", config.Cmd)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.WithMessage(err, "plugin "+config.Name)
+	}
+	p := &Plugin{
+		Config: config,
+		cmd:    cmd,
+		stdin:  stdin,
+		lines:  make(chan []byte),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) != 0 {
+				select {
+				case p.lines <- line:
+				case <-p.done:
+					return
+				}
+			}
+			if err != nil {
+				close(p.lines)
+				return
+			}
+		}
+	}()
+
+	result := new(PluginInitializeResult)
+	if err := p.Call(PluginMethodInitialize, map[string]string{"name": ApplicationName}, result); err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.Events = result.Events
+	return p, nil
+}
+
+func (p *Plugin) timeout() time.Duration {
+	if p.Config.Timeout > 0 {
+		return p.Config.Timeout
+	}
+	return defaultPluginTimeout
+}
+
+// call plugin synchronously, plugin is killed if it does not answer in timeout
+func (p *Plugin) Call(method string, params interface{}, result interface{}) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.dead {
+		return errors.Errorf("plugin %s is stopped", p.Config.Name)
+	}
+	p.id++
+	id := p.id
+	b, err := json.Marshal(&pluginRequest{Version: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if _, err := p.stdin.Write(append(b, '\n')); err != nil {
+		p.kill()
+		return errors.WithMessage(err, "plugin "+p.Config.Name)
+	}
+
+	timer := time.NewTimer(p.timeout())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			p.kill()
+			return errors.Errorf("plugin %s: %s timeout", p.Config.Name, method)
+		case line, ok := <-p.lines:
+			if !ok {
+				p.kill()
+				return errors.Errorf("plugin %s exited", p.Config.Name)
+			}
+			resp := new(pluginResponse)
+			// skip output that is not response
+			if err := json.Unmarshal(line, resp); err != nil || resp.ID != id {
+				continue
+			}
+			if resp.Error != nil {
+				return errors.Errorf("plugin %s: %s", p.Config.Name, resp.Error.Message)
+			}
+			if result == nil || len(resp.Result) == 0 {
+				return nil
+			}
+			return json.Unmarshal(resp.Result, result)
+		}
+	}
+}
+
+func (p *Plugin) kill() {
+	p.dead = true
+	close(p.done)
+	_ = p.stdin.Close()
+	if p.cmd.Process != nil {
+		_ = p.cmd.Process.Kill()
+	}
+	go func() {
+		_ = p.cmd.Wait()
+	}()
+}
+
+func (p *Plugin) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.dead {
+		p.kill()
+	}
+}
+
+// call event, and apply common fields of result
+func (p *Plugin) notify(ctx *EventContext, event string, params *PluginParams) (*PluginResult, error) {
+	node := ctx.Node
+	params.Node = &PluginNode{
+		Name:  node.Name,
+		Alias: node.Alias,
+		Host:  node.Host,
+		Port:  node.port(),
+		User:  node.user(),
+	}
+	result := new(PluginResult)
+	if err := p.Call(event, params, result); err != nil {
+		return nil, err
+	}
+	if result.Message != "" {
+		node.Println(result.Message)
+	}
+	if result.Error != "" {
+		return nil, errors.Errorf("plugin %s: %s", p.Config.Name, result.Error)
+	}
+	return result, nil
+}
+
+// subscribe events that plugin wants
+func (p *Plugin) Subscribe() error {
+	for _, event := range p.Events {
+		var handler interface{}
+		switch event {
+		case PostInitClientConfig:
+			handler = func(ctx *EventContext, clientConfig *ssh.ClientConfig) error {
+				result, err := p.notify(ctx, PostInitClientConfig, &PluginParams{})
+				if err != nil {
+					return err
+				}
+				if result.User != "" {
+					clientConfig.User = result.User
+				}
+				if result.Password != "" {
+					clientConfig.Auth = append(clientConfig.Auth, ssh.Password(result.Password))
+				}
+				return nil
+			}
+		case PostSSHDial:
+			handler = func(ctx *EventContext, client *ssh.Client) error {
+				_, err := p.notify(ctx, PostSSHDial, &PluginParams{ServerVersion: string(client.ServerVersion())})
+				return err
+			}
+		case PostNewSession:
+			handler = func(ctx *EventContext, session *ssh.Session) error {
+				_, err := p.notify(ctx, PostNewSession, &PluginParams{})
+				return err
+			}
+		case OnStdout, OnStderr:
+			e := event
+			handler = func(ctx *EventContext, line []byte) error {
+				_, err := p.notify(ctx, e, &PluginParams{Data: string(line)})
+				return err
+			}
+		case PostShell:
+			handler = func(ctx *EventContext, stdin io.WriteCloser) error {
+				result, err := p.notify(ctx, PostShell, &PluginParams{})
+				if err != nil {
+					return err
+				}
+				if result.Input != "" {
+					_, err = stdin.Write([]byte(result.Input))
+				}
+				return err
+			}
+		case PostSessionEnd:
+			handler = func(ctx *EventContext, sessionEnd *SessionEnd) error {
+				_, err := p.notify(ctx, PostSessionEnd, &PluginParams{
+					ExitStatus: sessionEnd.ExitStatus,
+					Duration:   int64(sessionEnd.Duration / time.Second),
+				})
+				return err
+			}
+		case OnAuthFailure:
+			handler = func(ctx *EventContext, authErr error) error {
+				_, err := p.notify(ctx, OnAuthFailure, &PluginParams{Error: authErr.Error()})
+				return err
+			}
+		case PostClose:
+			handler = func(ctx *EventContext, duration time.Duration) error {
+				_, err := p.notify(ctx, PostClose, &PluginParams{Duration: int64(duration / time.Second)})
+				return err
+			}
+		default:
+			return errors.Errorf("plugin %s: unknown event %s", p.Config.Name, event)
+		}
+		if err := bus.Subscribe(event, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	plugins          []*Plugin
+	startPluginsOnce sync.Once
+)
+
+// start plugins of global settings once, plugin failed to start is skipped
+// commands connecting nodes and daemon call it at startup, not every client of jump nodes
+func StartPlugins() {
+	startPluginsOnce.Do(func() {
+		for _, config := range globalSettings.Plugins {
+			plugin, err := StartPlugin(config)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			if err := plugin.Subscribe(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				plugin.Close()
+				continue
+			}
+			plugins = append(plugins, plugin)
+		}
+	})
+}
+
+func StopPlugins() {
+	for _, plugin := range plugins {
+		plugin.Close()
+	}
+}
@@ -0,0 +1,39 @@
+package sshwctl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// answer initialize, and then reply every request with a message
+const echoPlugin = `while read -r line; do
+  id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+  case "$line" in
+    *'"initialize"'*) echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"events\":[\"PostSSHDial\"]}}" ;;
+    *) echo "log line"; echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"user\":\"plugin\"}}" ;;
+  esac
+done`
+
+func TestPlugin(t *testing.T) {
+	ast := assert.New(t)
+
+	plugin, err := StartPlugin(&PluginConfig{Name: "echo", Cmd: echoPlugin})
+	if !ast.Nil(err) {
+		return
+	}
+	defer plugin.Close()
+	ast.Equal([]string{PostSSHDial}, plugin.Events)
+
+	result := new(PluginResult)
+	ast.Nil(plugin.Call(PostSSHDial, &PluginParams{}, result))
+	ast.Equal("plugin", result.User)
+}
+
+func TestPluginTimeout(t *testing.T) {
+	ast := assert.New(t)
+
+	_, err := StartPlugin(&PluginConfig{Name: "sleep", Cmd: "sleep 1", Timeout: 50 * time.Millisecond})
+	ast.NotNil(err)
+}
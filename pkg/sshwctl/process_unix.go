@@ -0,0 +1,22 @@
+// +build !windows
+
+package sshwctl
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// command and its children are in a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// kill process group of command if it has one, children would keep output pipe open
+func killCommand(cmd *exec.Cmd) {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		return
+	}
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,18 @@
+// +build !windows
+
+package sshwctl
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellCommandProcessGroup(t *testing.T) {
+	ast := assert.New(t)
+	// command reading terminal stays in the foreground process group
+	ast.Nil(shellCommand("read line", os.Stdin).SysProcAttr)
+	cmd := shellCommand("sleep 1", nil)
+	ast.True(cmd.SysProcAttr.Setpgid)
+}
@@ -0,0 +1,12 @@
+package sshwctl
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killCommand(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,136 @@
+package sshwctl
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var ErrPromptInterrupted = errors.New("prompt is interrupted")
+
+// ask user for password or answer of keyboard interactive
+// all of auth prompts should use it, stdin of node may not be a terminal
+type Prompter interface {
+	// if echo is false, input is invisible
+	Prompt(question string, echo bool) (string, error)
+}
+
+// choose prompter in order
+// 1. batch mode, always fail
+// 2. stdin of node is a terminal
+// 3. stdin of node is forwarded from a terminal, etc. session in daemon
+// 4. askpass of node or $SSH_ASKPASS
+func NewPrompter(node *Node) Prompter {
+	if node.BatchMode {
+		return &batchPrompter{reason: "batch mode"}
+	}
+	if f, ok := node.stdin().(*os.File); ok && terminal.IsTerminal(int(f.Fd())) {
+		return &terminalPrompter{f: f, w: node.stdout()}
+	}
+	if node.StdinTerminal {
+		return &streamPrompter{r: node.stdin(), w: node.stdout()}
+	}
+	if askpass := node.askpass(); askpass != "" {
+		return &askpassPrompter{cmd: askpass}
+	}
+	return &batchPrompter{reason: "stdin is not a terminal and askpass is not set"}
+}
+
+type batchPrompter struct {
+	reason string
+}
+
+func (b *batchPrompter) Prompt(question string, echo bool) (string, error) {
+	return "", errors.Errorf("can not prompt %q, %s", strings.TrimSpace(question), b.reason)
+}
+
+// terminal in cooked mode
+type terminalPrompter struct {
+	f *os.File
+	w io.Writer
+}
+
+func (t *terminalPrompter) Prompt(question string, echo bool) (string, error) {
+	_, _ = io.WriteString(t.w, question)
+	if echo {
+		// terminal echo by itself
+		return readAnswer(t.f, nil, false)
+	}
+	b, err := terminal.ReadPassword(int(t.f.Fd()))
+	_, _ = io.WriteString(t.w, "\n")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// terminal in raw mode at the other side of stream
+type streamPrompter struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (s *streamPrompter) Prompt(question string, echo bool) (string, error) {
+	_, _ = io.WriteString(s.w, question)
+	answer, err := readAnswer(s.r, s.w, echo)
+	_, _ = io.WriteString(s.w, "\r\n")
+	return answer, err
+}
+
+type askpassPrompter struct {
+	cmd string
+}
+
+func (a *askpassPrompter) Prompt(question string, echo bool) (string, error) {
+	command := exec.Command(Shell(), "-c", a.cmd+` "$1"`, "askpass", question)
+	command.Stderr = os.Stderr
+	out, err := command.Output()
+	if err != nil {
+		return "", errors.WithMessage(err, "askpass")
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// read until '\r' or '\n' byte by byte, avoid reading input of shell
+// if w is not nil, write input back
+func readAnswer(r io.Reader, w io.Writer, echo bool) (string, error) {
+	var answer []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 0 {
+			if err == io.EOF && len(answer) != 0 {
+				return string(answer), nil
+			}
+			if err == nil {
+				continue
+			}
+			return "", err
+		}
+		switch c := b[0]; c {
+		case '\r', '\n':
+			return string(answer), nil
+		// ctrl-c, ctrl-d
+		case 3, 4:
+			return "", ErrPromptInterrupted
+		// backspace, delete
+		case 8, 127:
+			if len(answer) == 0 {
+				continue
+			}
+			answer = answer[:len(answer)-1]
+			if echo && w != nil {
+				_, _ = w.Write([]byte("\b \b"))
+			}
+		default:
+			answer = append(answer, c)
+			if echo && w != nil {
+				_, _ = w.Write(b)
+			}
+		}
+	}
+}
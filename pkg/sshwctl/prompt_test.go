@@ -0,0 +1,47 @@
+package sshwctl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAnswer(t *testing.T) {
+	ast := assert.New(t)
+
+	out := bytes.NewBuffer(nil)
+	answer, err := readAnswer(strings.NewReader("pas\x7fss\rnext"), out, true)
+	ast.Nil(err)
+	ast.Equal("pass", answer)
+	ast.Equal("pas\b \bss", out.String())
+
+	out.Reset()
+	answer, err = readAnswer(strings.NewReader("secret\n"), out, false)
+	ast.Nil(err)
+	ast.Equal("secret", answer)
+	ast.Equal("", out.String())
+
+	_, err = readAnswer(strings.NewReader("sec\x03"), out, false)
+	ast.Equal(ErrPromptInterrupted, err)
+}
+
+func TestNewPrompter(t *testing.T) {
+	ast := assert.New(t)
+
+	node := &Node{BatchMode: true, Askpass: "echo secret"}
+	_, err := NewPrompter(node).Prompt("password:", false)
+	ast.NotNil(err)
+
+	stdin := &customReadCloser{r: strings.NewReader("secret\r"), c: nil}
+	node = &Node{Stdin: stdin, Stdout: bytes.NewBuffer(nil), StdinTerminal: true}
+	answer, err := NewPrompter(node).Prompt("password:", false)
+	ast.Nil(err)
+	ast.Equal("secret", answer)
+
+	node = &Node{Stdin: stdin, Askpass: "echo"}
+	answer, err = NewPrompter(node).Prompt("password:", false)
+	ast.Nil(err)
+	ast.Equal("password:", answer)
+}
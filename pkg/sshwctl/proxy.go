@@ -0,0 +1,89 @@
+package sshwctl
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// run ProxyCommand, its stdin and stdout are the connection to ssh server
+// %h, %p, %r and %n of command are replaced like ssh
+func DialProxyCommand(node *Node) (net.Conn, error) {
+	alias := node.alias()
+	if alias == "" {
+		alias = node.Name
+	}
+	command := expandSshTokens(node.ProxyCommand, alias, node)
+	cmd := exec.Command(Shell(), "-c", command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.WithMessage(err, "proxy command "+command)
+	}
+	return &proxyCommandConn{cmd: cmd, stdin: stdin, stdout: stdout, addr: proxyCommandAddr(command)}, nil
+}
+
+type proxyCommandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	addr   net.Addr
+}
+
+func (p *proxyCommandConn) Read(b []byte) (int, error) {
+	return p.stdout.Read(b)
+}
+
+func (p *proxyCommandConn) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+func (p *proxyCommandConn) Close() error {
+	_ = p.stdin.Close()
+	if p.cmd.Process != nil {
+		_ = p.cmd.Process.Kill()
+	}
+	_ = p.cmd.Wait()
+	return nil
+}
+
+func (p *proxyCommandConn) LocalAddr() net.Addr {
+	return p.addr
+}
+
+func (p *proxyCommandConn) RemoteAddr() net.Addr {
+	return p.addr
+}
+
+func (p *proxyCommandConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (p *proxyCommandConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (p *proxyCommandConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type proxyCommandAddr string
+
+func (p proxyCommandAddr) Network() string {
+	return "proxy-command"
+}
+
+func (p proxyCommandAddr) String() string {
+	return string(p)
+}
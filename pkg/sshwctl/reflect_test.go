@@ -2,6 +2,7 @@ package sshwctl
 
 import (
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"reflect"
 	"testing"
 )
@@ -106,3 +107,27 @@ func TestFieldsEmpty(t *testing.T) {
 		})
 	}
 }
+
+func TestCopyNode(t *testing.T) {
+	ast := assert.New(t)
+	stdin := ioutil.NopCloser(nil)
+	node := &Node{
+		Name:          "a",
+		Jump:          []*Node{{Name: "jump", Password: "${env:PASSWORD}"}},
+		ExecsPre:      []*NodeExec{{Cmd: "echo", Var: "token"}},
+		Vars:          map[string]string{"token": ""},
+		IdentityFiles: []string{"~/.ssh/id_rsa"},
+		Stdin:         stdin,
+	}
+	c := CopyNode(node)
+	ast.Equal(node, c)
+	c.Jump[0].Password = "secret"
+	c.ExecsPre[0].Cmd = "true"
+	c.Vars["token"] = "xxx"
+	c.IdentityFiles[0] = "/root/.ssh/id_rsa"
+	ast.Equal("${env:PASSWORD}", node.Jump[0].Password)
+	ast.Equal("echo", node.ExecsPre[0].Cmd)
+	ast.Equal("", node.Vars["token"])
+	ast.Equal("~/.ssh/id_rsa", node.IdentityFiles[0])
+	ast.Equal(stdin, c.Stdin)
+}
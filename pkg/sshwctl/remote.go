@@ -0,0 +1,227 @@
+package sshwctl
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// value of Authorization header of remote config
+	EnvRemoteAuthorization = "SSHW_REMOTE_AUTHORIZATION"
+	// headers of remote config, `Key: Value` separated by newline or ;
+	EnvRemoteHeaders = "SSHW_REMOTE_HEADERS"
+	// pem file of CA certificates of remote config
+	EnvRemoteCaFile = "SSHW_REMOTE_CA_FILE"
+
+	defaultRemoteTimeout = 30 * time.Second
+)
+
+var (
+	RemoteCacheDir = path.Join(SshwDir, "cache")
+	// config of -f, env of remote config is sent to its origin only, etc. not to hosts of its includes
+	RemoteConfigUrl string
+)
+
+// options of remote config urls, written in settings of global config
+// etc.
+// remotes:
+//   - url: https://config.example.com/
+//     headers: {Authorization: "Bearer ${env:CONFIG_TOKEN}"}
+//     ca-file: ~/.config/sshw/ca.pem
+type RemoteConfig struct {
+	// prefix of urls
+	Url string `yaml:"url"`
+	// values may be templates
+	Headers map[string]string `yaml:"headers,omitempty"`
+	CaFile  string            `yaml:"ca-file,omitempty"`
+	// default is 30s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// validators of cached response
+type remoteCacheMeta struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last-modified,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// options of the longest matched url, env overrides it
+// env is used only if url is matched by remotes, or it has the same origin as RemoteConfigUrl
+func remoteConfigOf(url string) *RemoteConfig {
+	var remote *RemoteConfig
+	for _, r := range globalSettings.Remotes {
+		if remoteUrlMatched(r.Url, url) && (remote == nil || len(r.Url) >= len(remote.Url)) {
+			remote = r
+		}
+	}
+	c := &RemoteConfig{Headers: make(map[string]string)}
+	if remote != nil {
+		c.Url, c.CaFile, c.Timeout = remote.Url, remote.CaFile, remote.Timeout
+		for key, value := range remote.Headers {
+			c.Headers[key] = value
+		}
+	} else if origin := urlOrigin(url); origin == "" || origin != urlOrigin(RemoteConfigUrl) {
+		return c
+	}
+	for _, header := range strings.FieldsFunc(os.Getenv(EnvRemoteHeaders), func(r rune) bool {
+		return r == '\n' || r == ';'
+	}) {
+		if kv := strings.SplitN(header, ":", 2); len(kv) == 2 {
+			c.Headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	if authorization := os.Getenv(EnvRemoteAuthorization); authorization != "" {
+		c.Headers["Authorization"] = authorization
+	}
+	if caFile := os.Getenv(EnvRemoteCaFile); caFile != "" {
+		c.CaFile = caFile
+	}
+	return c
+}
+
+// scheme and host are the same as prefix, and path of prefix is a directory or the file of url
+// etc. https://config.example.com/team matches https://config.example.com/team/sshw.yaml, but not https://config.example.com/team-b/sshw.yaml
+func remoteUrlMatched(prefix, s string) bool {
+	prefixUri, err := url.ParseRequestURI(prefix)
+	if err != nil || prefixUri.Host == "" {
+		return false
+	}
+	uri, err := url.ParseRequestURI(s)
+	if err != nil || !strings.EqualFold(prefixUri.Scheme, uri.Scheme) || !strings.EqualFold(prefixUri.Host, uri.Host) {
+		return false
+	}
+	dir := strings.TrimSuffix(prefixUri.Path, "/")
+	return uri.Path == dir || strings.HasPrefix(uri.Path, dir+"/")
+}
+
+// scheme and host of url, empty if it is not an url
+func urlOrigin(s string) string {
+	uri, err := url.ParseRequestURI(s)
+	if err != nil || uri.Host == "" {
+		return ""
+	}
+	return strings.ToLower(uri.Scheme + "://" + uri.Host)
+}
+
+func (r *RemoteConfig) client() (*http.Client, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+	client := &http.Client{Timeout: timeout, CheckRedirect: r.checkRedirect}
+	if r.CaFile == "" {
+		return client, nil
+	}
+	pem, err := ioutil.ReadFile(AbsPath(r.CaFile))
+	if err != nil {
+		return nil, errors.WithMessage(err, "read ca file")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificate in %s", r.CaFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	client.Transport = transport
+	return client, nil
+}
+
+// headers are not sent to another origin by redirect, http.Client drops Authorization only
+func (r *RemoteConfig) checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if urlOrigin(request.URL.String()) != urlOrigin(via[0].URL.String()) {
+		for key := range r.Headers {
+			request.Header.Del(key)
+		}
+	}
+	return nil
+}
+
+func remoteCachePath(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return path.Join(RemoteCacheDir, hex.EncodeToString(sum[:8]))
+}
+
+// get remote config, response is cached and revalidated by ETag or Last-Modified
+// cache is used if server can not be reached, response other than 200 is an error
+func FetchRemoteConfig(url string) ([]byte, error) {
+	remote := remoteConfigOf(url)
+	cachePath := remoteCachePath(url)
+	cached, cacheErr := ioutil.ReadFile(cachePath + ".yaml")
+	meta := new(remoteCacheMeta)
+	if cacheErr == nil {
+		if b, err := ioutil.ReadFile(cachePath + ".json"); err == nil {
+			_ = json.Unmarshal(b, meta)
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range remote.Headers {
+		if value, err = ParseSshwTemplate(value).ExecuteContext(nil); err != nil {
+			return nil, errors.WithMessage(err, "header "+key)
+		}
+		request.Header.Set(key, value)
+	}
+	if cacheErr == nil {
+		if meta.ETag != "" {
+			request.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			request.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	client, err := remote.client()
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		if cacheErr == nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v, use cache of %s\n", err, meta.Time.Format(time.RFC3339))
+			return cached, nil
+		}
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if cacheErr == nil {
+			return cached, nil
+		}
+		fallthrough
+	default:
+		return nil, errors.Errorf("get %s: %s", url, response.Status)
+	}
+	b, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	meta = &remoteCacheMeta{ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified"), Time: time.Now()}
+	if err := os.MkdirAll(RemoteCacheDir, 0700); err == nil {
+		metaBytes, _ := json.Marshal(meta)
+		if ioutil.WriteFile(cachePath+".yaml", b, 0600) == nil {
+			_ = ioutil.WriteFile(cachePath+".json", metaBytes, 0600)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,186 @@
+package sshwctl
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchRemoteConfig(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	cacheDir := RemoteCacheDir
+	RemoteCacheDir = path.Join(dir, "cache")
+	settings := globalSettings
+	globalSettings = new(Settings)
+	defer func() {
+		RemoteCacheDir = cacheDir
+		globalSettings = settings
+	}()
+
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("X-Team") != "ops" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/sshw.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("- name: web\n  host: 10.0.0.1\n"))
+	}))
+	caFile := path.Join(dir, "ca.pem")
+	_ = ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	// certificate of server is unknown
+	_, err := FetchRemoteConfig(server.URL + "/sshw.yaml")
+	ast.NotNil(err)
+
+	globalSettings.Remotes = []*RemoteConfig{
+		{Url: "https://", Headers: map[string]string{"X-Team": "dev"}},
+		{Url: server.URL, Headers: map[string]string{"X-Team": "ops"}, CaFile: caFile},
+	}
+	_ = os.Setenv(EnvRemoteAuthorization, "Bearer token")
+	defer os.Unsetenv(EnvRemoteAuthorization)
+
+	for i := 0; i < 2; i++ {
+		b, err := FetchRemoteConfig(server.URL + "/sshw.yaml")
+		ast.Nil(err)
+		ast.Equal("- name: web\n  host: 10.0.0.1\n", string(b))
+	}
+
+	_, err = FetchRemoteConfig(server.URL + "/missing.yaml")
+	ast.EqualError(err, "get "+server.URL+"/missing.yaml: 404 Not Found")
+
+	// offline
+	server.Close()
+	b, err := FetchRemoteConfig(server.URL + "/sshw.yaml")
+	ast.Nil(err)
+	ast.Equal("- name: web\n  host: 10.0.0.1\n", string(b))
+	_, err = FetchRemoteConfig(server.URL + "/missing.yaml")
+	ast.NotNil(err)
+	ast.Equal(3, requests)
+}
+
+func TestRemoteConfigOf(t *testing.T) {
+	ast := assert.New(t)
+	settings, configUrl := globalSettings, RemoteConfigUrl
+	globalSettings = &Settings{Remotes: []*RemoteConfig{{Url: "https://team.example.com/", Headers: map[string]string{"X-Team": "ops"}}}}
+	RemoteConfigUrl = "https://config.example.com/sshw.yaml"
+	defer func() {
+		globalSettings, RemoteConfigUrl = settings, configUrl
+	}()
+	_ = os.Setenv(EnvRemoteAuthorization, "Bearer token")
+	defer os.Unsetenv(EnvRemoteAuthorization)
+
+	// env is sent to origin of -f, and urls of remotes
+	ast.Equal(map[string]string{"Authorization": "Bearer token"}, remoteConfigOf("https://config.example.com/prod.yaml").Headers)
+	ast.Equal(map[string]string{"Authorization": "Bearer token", "X-Team": "ops"}, remoteConfigOf("https://team.example.com/sshw.yaml").Headers)
+	// not to hosts included by remote config
+	ast.Empty(remoteConfigOf("https://other.example.com/sshw.yaml").Headers)
+	ast.Empty(remoteConfigOf("http://config.example.com/sshw.yaml").Headers)
+	RemoteConfigUrl = "sshw.yaml"
+	ast.Empty(remoteConfigOf("https://config.example.com/sshw.yaml").Headers)
+	// prefix is matched by scheme, host and directories of path
+	globalSettings.Remotes[0].Url = "https://team.example.com/ops"
+	ast.Equal("ops", remoteConfigOf("https://team.example.com/ops/sshw.yaml").Headers["X-Team"])
+	ast.Equal("ops", remoteConfigOf("https://team.example.com/ops").Headers["X-Team"])
+	ast.Empty(remoteConfigOf("https://team.example.com/ops-b/sshw.yaml").Headers)
+	ast.Empty(remoteConfigOf("https://team.example.com.evil.com/ops/sshw.yaml").Headers)
+	ast.Empty(remoteConfigOf("https://team.example.com:8443/ops/sshw.yaml").Headers)
+}
+
+func TestFetchRemoteConfigRedirect(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	cacheDir := RemoteCacheDir
+	RemoteCacheDir = path.Join(dir, "cache")
+	settings := globalSettings
+	defer func() {
+		RemoteCacheDir = cacheDir
+		globalSettings = settings
+	}()
+
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range []string{"Authorization", "X-Team"} {
+			if r.Header.Get(key) != "" {
+				leaked = append(leaked, key)
+			}
+		}
+		_, _ = w.Write([]byte("- name: moved"))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved.yaml" {
+			http.Redirect(w, r, "/sshw.yaml", http.StatusFound)
+			return
+		}
+		if r.Header.Get("X-Team") != "ops" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, other.URL+"/sshw.yaml", http.StatusFound)
+	}))
+	defer server.Close()
+	globalSettings = &Settings{Remotes: []*RemoteConfig{{Url: server.URL, Headers: map[string]string{"Authorization": "Bearer token", "X-Team": "ops"}}}}
+
+	// headers are kept by redirect to the same origin, and dropped by redirect to another
+	b, err := FetchRemoteConfig(server.URL + "/moved.yaml")
+	ast.Nil(err)
+	ast.Equal("- name: moved", string(b))
+	ast.Empty(leaked)
+}
+
+func TestLoadGlobalConfigRemotes(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Team") != "ops" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("- name: web\n"))
+	}))
+	defer server.Close()
+
+	globalPath, cacheDir, settings, config := SshwGlobalConfigPath, RemoteCacheDir, globalSettings, globalConfig
+	SshwGlobalConfigPath, RemoteCacheDir, globalSettings = path.Join(dir, "config.yaml"), path.Join(dir, "cache"), new(Settings)
+	defer func() {
+		SshwGlobalConfigPath, RemoteCacheDir, globalSettings, globalConfig = globalPath, cacheDir, settings, config
+	}()
+	_ = ioutil.WriteFile(SshwGlobalConfigPath, []byte(`
+include: [`+server.URL+`/sshw.yaml]
+remotes:
+  - url: `+server.URL+`
+    headers: {X-Team: ops}
+`), 0600)
+
+	// global config is read as a local file, nothing is fetched before its remotes are known
+	loadGlobalConfig()
+	ast.Equal(0, requests)
+	ast.Len(globalSettings.Remotes, 1)
+
+	b, err := FetchRemoteConfig(server.URL + "/sshw.yaml")
+	ast.Nil(err)
+	ast.Equal("- name: web\n", string(b))
+	ast.Equal(1, requests)
+}
@@ -0,0 +1,147 @@
+package sshwctl
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// node found by ResolveNodes, path is names of bookmarks and node, etc. prod/eu/db-1
+type ResolvedNode struct {
+	Node *Node
+	Path string
+	// matched by fuzzy level, it should be confirmed before login
+	Fuzzy bool
+}
+
+// find nodes by alias or path of names, the first level with matches wins
+// 1. alias
+// 2. path, etc. prod/eu/db-1
+// 3. end of path, etc. eu/db-1 or db-1
+// 4. prefix of alias, or prefixes of the end of path, etc. pr/e/db
+// 5. fuzzy, characters of query are in order in alias or path, case is ignored, etc. prdb1
+// nodes with children are not resolved unless they have alias
+// several nodes are returned if query is ambiguous
+func ResolveNodes(nodes []*Node, query string) []*ResolvedNode {
+	query = strings.Trim(query, "/")
+	if query == "" {
+		return nil
+	}
+	candidates := resolveCandidates(nodes)
+	segments := strings.Split(query, "/")
+	levels := []func(c *ResolvedNode) bool{
+		func(c *ResolvedNode) bool {
+			return c.Node.Alias == query
+		},
+		func(c *ResolvedNode) bool {
+			return c.Path == query
+		},
+		func(c *ResolvedNode) bool {
+			return strings.HasSuffix(c.Path, "/"+query)
+		},
+		func(c *ResolvedNode) bool {
+			if c.Node.Alias != "" && strings.HasPrefix(strings.ToLower(c.Node.Alias), strings.ToLower(query)) {
+				return true
+			}
+			return matchPathPrefixes(strings.Split(c.Path, "/"), segments)
+		},
+		func(c *ResolvedNode) bool {
+			return fuzzyMatch(c.Node.Alias, query) || fuzzyMatch(c.Path, query)
+		},
+	}
+	for i, level := range levels {
+		var matched []*ResolvedNode
+		for _, c := range candidates {
+			if level(c) {
+				c.Fuzzy = i == len(levels)-1
+				matched = append(matched, c)
+			}
+		}
+		if len(matched) != 0 {
+			return matched
+		}
+	}
+	return nil
+}
+
+func resolveCandidates(nodes []*Node) []*ResolvedNode {
+	var candidates []*ResolvedNode
+	var walk func(nodes []*Node, prefix string)
+	walk = func(nodes []*Node, prefix string) {
+		for _, node := range nodes {
+			p := joinNodePath(prefix, node.Name)
+			if len(node.Children) == 0 || node.Alias != "" {
+				candidates = append(candidates, &ResolvedNode{Node: node, Path: p})
+			}
+			walk(node.Children, p)
+		}
+	}
+	walk(nodes, "")
+	return candidates
+}
+
+// every segment of query is a prefix of segment at the end of path
+func matchPathPrefixes(path, segments []string) bool {
+	offset := len(path) - len(segments)
+	if offset < 0 {
+		return false
+	}
+	for i, segment := range segments {
+		if !strings.HasPrefix(strings.ToLower(path[offset+i]), strings.ToLower(segment)) {
+			return false
+		}
+	}
+	return true
+}
+
+// characters of query are in s in order, case is ignored
+func fuzzyMatch(s, query string) bool {
+	if s == "" {
+		return false
+	}
+	s, query = strings.ToLower(s), strings.ToLower(query)
+	for _, r := range query {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
+
+// { [alias]: paths of nodes } of aliases used by more than one node
+func DuplicateAliases(nodes []*Node) map[string][]string {
+	paths := make(map[string][]string)
+	var walk func(nodes []*Node, prefix string)
+	walk = func(nodes []*Node, prefix string) {
+		for _, node := range nodes {
+			p := joinNodePath(prefix, node.Name)
+			if node.Alias != "" {
+				paths[node.Alias] = append(paths[node.Alias], p)
+			}
+			walk(node.Children, p)
+		}
+	}
+	walk(nodes, "")
+	for alias, p := range paths {
+		if len(p) < 2 {
+			delete(paths, alias)
+		}
+	}
+	return paths
+}
+
+// print aliases used by more than one node, they are resolved by a prompt
+func WarnDuplicateAliases(nodes []*Node, warn io.Writer) {
+	duplicates := DuplicateAliases(nodes)
+	aliases := make([]string, 0, len(duplicates))
+	for alias := range duplicates {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		_, _ = fmt.Fprintf(warn, "warning: alias %s is used by %s\n", alias, strings.Join(duplicates[alias], ", "))
+	}
+}
@@ -0,0 +1,76 @@
+package sshwctl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveNodes(t *testing.T) {
+	ast := assert.New(t)
+	nodes, err := LoadYamlConfig0([]byte(`
+- name: prod
+  children:
+    - name: eu
+      children:
+        - {name: db-1, host: db1.eu}
+        - {name: db-2, host: db2.eu}
+        - {name: master, host: k8s.eu, alias: master}
+    - name: us
+      children:
+        - {name: db-1, host: db1.us}
+        - {name: master, host: k8s.us, alias: master}
+- name: bastion
+  host: bastion.example.com
+  alias: jump
+`))
+	ast.Nil(err)
+
+	paths := func(query string) []string {
+		var p []string
+		for _, resolved := range ResolveNodes(nodes, query) {
+			p = append(p, resolved.Path)
+		}
+		return p
+	}
+	// alias
+	ast.Equal([]string{"bastion"}, paths("jump"))
+	ast.Equal([]string{"prod/eu/master", "prod/us/master"}, paths("master"))
+	// path
+	ast.Equal([]string{"prod/eu/db-1"}, paths("prod/eu/db-1"))
+	ast.Equal([]string{"prod/eu/db-1"}, paths("/prod/eu/db-1/"))
+	ast.Equal([]string{"bastion"}, paths("bastion"))
+	// end of path
+	ast.Equal([]string{"prod/us/db-1"}, paths("us/db-1"))
+	ast.Equal([]string{"prod/eu/db-1", "prod/us/db-1"}, paths("db-1"))
+	// prefix
+	ast.Equal([]string{"prod/eu/db-1", "prod/eu/db-2"}, paths("eu/db"))
+	ast.Equal([]string{"prod/eu/db-1", "prod/eu/db-2"}, paths("p/e/db"))
+	ast.Equal([]string{"prod/us/db-1"}, paths("u/D"))
+	ast.Equal([]string{"bastion"}, paths("ju"))
+	// fuzzy
+	ast.Equal([]string{"prod/us/db-1"}, paths("usdb1"))
+	ast.Equal([]string{"prod/eu/db-2"}, paths("edb2"))
+	ast.True(ResolveNodes(nodes, "edb2")[0].Fuzzy)
+	ast.False(ResolveNodes(nodes, "u/D")[0].Fuzzy)
+	// nothing
+	ast.Empty(paths("web"))
+	ast.Empty(paths(""))
+	// bookmark is not a node to login
+	ast.Equal([]string{"prod/eu/db-1", "prod/eu/db-2", "prod/eu/master"}, paths("prod/eu"))
+}
+
+func TestDuplicateAliases(t *testing.T) {
+	ast := assert.New(t)
+	nodes := []*Node{
+		{Name: "a", Children: []*Node{{Name: "master", Alias: "master"}, {Name: "web", Alias: "web"}}},
+		{Name: "b", Children: []*Node{{Name: "master", Alias: "master"}}},
+		{Name: "c", Alias: "web"},
+	}
+	ast.Equal(map[string][]string{"master": {"a/master", "b/master"}, "web": {"a/web", "c"}}, DuplicateAliases(nodes))
+
+	warn := bytes.NewBuffer(nil)
+	WarnDuplicateAliases(nodes, warn)
+	ast.Equal("warning: alias master is used by a/master, b/master\nwarning: alias web is used by a/web, c\n", warn.String())
+}
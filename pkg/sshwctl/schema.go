@@ -0,0 +1,168 @@
+package sshwctl
+
+import (
+	"reflect"
+)
+
+const (
+	JsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	// typed fields may be templates, see template_yaml.go
+	templatePattern = `\$\{.+\}`
+	durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|` + templatePattern
+)
+
+// description of fields in schema, key is `Type.Field`
+// every yaml field of schema types should have one, see TestNodeSchema
+var schemaDescriptions = map[string]string{
+	"Node.Name":                  "name shown in the list, or Host of .ssh/config",
+	"Node.Alias":                 "login directly by `sshw <alias>`",
+	"Node.ExecsPre":              "local commands run before connecting, `var` keeps stdout as var of node",
+	"Node.ExecsStop":             "local commands run after session",
+	"Node.Host":                  "address of ssh server, or Host of .ssh/config, ranges are expanded, etc. web[01-12].example.com",
+	"Node.User":                  "login user, default is $USER",
+	"Node.Port":                  "port of ssh server, default is 22",
+	"Node.KeyPath":               "private key file",
+	"Node.Passphrase":            "passphrase of private key",
+	"Node.Password":              "password, or `enc:` secret encrypted by `sshw secret encrypt`",
+	"Node.CallbackShells":        "commands typed into session after login",
+	"Node.Scps":                  "copy files instead of opening session",
+	"Node.Children":              "nodes of bookmark",
+	"Node.Jump":                  "jump hosts, connected in order",
+	"Node.MergeIgnore":           "skip node in `sshw merge`",
+	"Node.KeyboardInteractions":  "answers of keyboard interactive questions",
+	"Node.ControlMaster":         "share connection by sshw daemon",
+	"Node.IdleTimeout":           "close session if there is no traffic, etc. 15m",
+	"Node.Askpass":               "command to ask password if stdin is not a terminal, default is $SSH_ASKPASS",
+	"Node.BatchMode":             "never prompt, auth fails if it needs input",
+	"Node.CredentialHelper":      "command to get password, passphrase and answers",
+	"Node.OnConnect":             "local commands run after connecting",
+	"Node.OnDisconnect":          "local commands run after disconnecting",
+	"Node.OnAuthFailure":         "local commands run if auth fails",
+	"Node.OnSessionEnd":          "local commands run after session ends",
+	"Node.Vars":                  "variables of node and its children, read by templates before env",
+	"Node.Include":               "files, globs or urls of children",
+	"Node.Defaults":              "default fields of descendants",
+	"Node.Tags":                  "tags of node, inherited by children, filtered by --tag and matched by match-tags of global config",
+	"Node.Range":                 "expand node by numbers, value is var i, etc. 01-12 or 1-3,7",
+	"Node.ForEach":               "expand node by values, value is var i, or j after range",
+	"Node.HostPattern":           "only global config, ssh style host patterns, etc. *.prod.example.com,!db.prod.example.com",
+	"Node.Cidr":                  "only global config, match host in cidr, etc. 10.20.0.0/16",
+	"Node.MatchTags":             "only global config, match nodes with all tags",
+	"Node.ProxyCommand":          "command connected to ssh server by stdin and stdout, etc. nc %h %p",
+	"Node.LocalForward":          "like ssh -L, etc. `8080 localhost:80`",
+	"Node.RemoteForward":         "like ssh -R, etc. `8080 localhost:80`",
+	"Node.ServerAliveInterval":   "send keepalive in interval, etc. 30s",
+	"Node.ServerAliveCountMax":   "close connection after count of keepalive failures, default is 3",
+	"Node.StrictHostKeyChecking": "yes, accept-new, ask or no(default)",
+	"Node.UserKnownHostsFile":    "known hosts file, default is ~/.ssh/known_hosts",
+	"Node.CertificateFile":       "certificate of keypath",
+	"Node.IdentityFiles":         "private key files tried after keypath",
+
+	"NodeExec.Cmd":     "shell command",
+	"NodeExec.Var":     "name of var that keeps stdout of command",
+	"NodeExec.Timeout": "kill command if it runs too long, 0 means never",
+
+	"NodeCallbackShell.Cmd":          "command typed into session",
+	"NodeCallbackShell.Delay":        "wait before typing command",
+	"NodeCallbackShell.ErrorPattern": "stop callback shells if output matches regexp",
+	"NodeCallbackShell.Wait":         "wait output after typing command",
+
+	"NodeCp.Src":       "source file",
+	"NodeCp.Tgt":       "target file",
+	"NodeCp.IsReceive": "copy from server to local",
+	"NodeCp.Timeout":   "seconds",
+
+	"KeyboardInteractive.Question":   "answer question that contains it",
+	"KeyboardInteractive.Answer":     "answer, or base32 secret and otpauth uri if google-auth",
+	"KeyboardInteractive.GoogleAuth": "answer one-time password",
+
+	"configDocument.Include":   "files, globs or urls of nodes",
+	"configDocument.Inventory": "nodes from commands or http endpoints",
+
+	"InventorySource.Name":    "bookmark of nodes",
+	"InventorySource.Type":    "exec or http",
+	"InventorySource.Cmd":     "command prints nodes as json or yaml",
+	"InventorySource.Url":     "json endpoint",
+	"InventorySource.Headers": "headers of request, values may be templates",
+	"InventorySource.Items":   "path of list in output, etc. data.hosts",
+	"InventorySource.Fields":  "node fields rendered with every item by ${item:path}",
+	"InventorySource.TTL":     "output is cached, default is 10m",
+	"InventorySource.Timeout": "default is 30s",
+}
+
+// json schema of config, a node or a list of nodes in every yaml document
+// it is generated from yaml tags of Node and the types of its fields
+func NodeSchema() map[string]interface{} {
+	definitions := make(map[string]interface{})
+	node := structSchema(reflect.TypeOf(Node{}), definitions)
+	return map[string]interface{}{
+		"$schema":     JsonSchemaDraft,
+		"title":       "sshw config",
+		"definitions": definitions,
+		"anyOf": []interface{}{
+			map[string]interface{}{"type": "array", "items": node},
+			node,
+			structSchema(reflect.TypeOf(configDocument{}), definitions),
+		},
+	}
+}
+
+// struct is a definition, it returns $ref of the definition
+func structSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	ref := map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	if _, has := definitions[t.Name()]; has {
+		return ref
+	}
+	properties := make(map[string]interface{})
+	definition := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	// recursive type refers to itself
+	definitions[t.Name()] = definition
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := yamlFieldName(field)
+		if name == "" {
+			continue
+		}
+		property := typeSchema(field.Type, definitions)
+		if description, has := schemaDescriptions[t.Name()+"."+field.Name]; has {
+			// $ref ignores siblings in draft-07
+			if _, isRef := property["$ref"]; isRef {
+				property = map[string]interface{}{"allOf": []interface{}{property}}
+			}
+			property["description"] = description
+		}
+		properties[name] = property
+	}
+	return ref
+}
+
+func typeSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	template := map[string]interface{}{"type": "string", "pattern": templatePattern}
+	switch {
+	case t == durationType:
+		return map[string]interface{}{"anyOf": []interface{}{
+			map[string]interface{}{"type": "integer"},
+			map[string]interface{}{"type": "string", "pattern": durationPattern},
+		}}
+	case t.Kind() == reflect.Struct:
+		return structSchema(t, definitions)
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), definitions)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), definitions)}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "boolean"}, template}}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "integer"}, template}}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "number"}, template}}
+	}
+	return map[string]interface{}{"type": "string"}
+}
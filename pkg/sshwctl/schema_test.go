@@ -0,0 +1,34 @@
+package sshwctl
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeSchema(t *testing.T) {
+	ast := assert.New(t)
+	schema := NodeSchema()
+	_, err := json.Marshal(schema)
+	ast.Nil(err)
+
+	definitions := schema["definitions"].(map[string]interface{})
+	for _, name := range []string{"Node", "NodeExec", "NodeCallbackShell", "NodeCp", "KeyboardInteractive"} {
+		ast.Contains(definitions, name)
+	}
+	// field doc table is in sync with types
+	for name, definition := range definitions {
+		for key, property := range definition.(map[string]interface{})["properties"].(map[string]interface{}) {
+			ast.Contains(property, "description", name+"."+key)
+		}
+	}
+
+	properties := definitions["Node"].(map[string]interface{})["properties"].(map[string]interface{})
+	ast.NotContains(properties, "stdin")
+	ast.Equal(map[string]interface{}{"type": "string", "description": "address of ssh server, or Host of .ssh/config, ranges are expanded, etc. web[01-12].example.com"}, properties["host"])
+	ast.Equal(map[string]interface{}{"$ref": "#/definitions/Node"}, properties["children"].(map[string]interface{})["items"])
+	ast.Equal(map[string]interface{}{"$ref": "#/definitions/Node"}, properties["defaults"].(map[string]interface{})["allOf"].([]interface{})[0])
+	ast.Contains(definitions["KeyboardInteractive"].(map[string]interface{})["properties"], "question")
+	ast.Contains(definitions["NodeCp"].(map[string]interface{})["properties"], "timeout")
+}
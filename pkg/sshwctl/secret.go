@@ -0,0 +1,237 @@
+package sshwctl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// value of encrypted field, etc. `password: enc:<base64>`
+	SecretPrefix = "enc:"
+	// yaml tag of encrypted field, etc. `password: !encrypted <base64>`
+	SecretTag = "!encrypted"
+	// passphrase used instead of MasterKeyPath
+	EnvMasterPassphrase = "SSHW_MASTER_PASSPHRASE"
+
+	secretSaltSize = 16
+)
+
+var (
+	// random key generated by `sshw secret encrypt` if there is no passphrase
+	MasterKeyPath = path.Join(SshwDir, "master.key")
+
+	defaultSecretBox     *SecretBox
+	defaultSecretBoxLock sync.Mutex
+)
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, SecretPrefix)
+}
+
+// rewrite `!encrypted <base64>` to `enc:<base64>`, yaml.v2 does not know the tag
+// bytes are returned as they are if they are not yaml, decoding reports it
+func rewriteSecretTag(bs []byte) []byte {
+	if !bytes.Contains(bs, []byte(SecretTag)) {
+		return bs
+	}
+	documents, err := ParseYamlDocuments(bs)
+	if err != nil || !documents.rewriteSecretTags() {
+		return bs
+	}
+	out, err := documents.Bytes()
+	if err != nil {
+		return bs
+	}
+	return out
+}
+
+// rewrite tagged scalars of tree, lines of block scalar are joined, return false if there is none
+func (d *YamlDocuments) rewriteSecretTags() bool {
+	rewritten := false
+	var walk func(node *yamlv3.Node)
+	walk = func(node *yamlv3.Node) {
+		if node.Kind == yamlv3.ScalarNode && node.Tag == SecretTag {
+			node.Tag = "!!str"
+			node.Value = SecretPrefix + strings.Join(strings.Fields(node.Value), "")
+			node.Style = 0
+			rewritten = true
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	for _, doc := range d.Docs {
+		walk(doc)
+	}
+	return rewritten
+}
+
+// encrypt and decrypt fields by master secret
+// key is derived from master secret by scrypt, cipher is xchacha20-poly1305
+// encrypted value is `enc:` + base64(salt | nonce | ciphertext)
+type SecretBox struct {
+	master []byte
+	salt   []byte
+	// { [salt]: [key] }, scrypt is slow
+	keys map[string][]byte
+}
+
+func NewSecretBox(master []byte) (*SecretBox, error) {
+	if len(master) == 0 {
+		return nil, errors.New("master secret is empty")
+	}
+	salt := make([]byte, secretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &SecretBox{master: master, salt: salt, keys: make(map[string][]byte)}, nil
+}
+
+func (s *SecretBox) key(salt []byte) ([]byte, error) {
+	if key, has := s.keys[string(salt)]; has {
+		return key, nil
+	}
+	key, err := scrypt.Key(s.master, salt, 1<<15, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	s.keys[string(salt)] = key
+	return key, nil
+}
+
+func (s *SecretBox) Encrypt(plaintext string) (string, error) {
+	key, err := s.key(s.salt)
+	if err != nil {
+		return "", err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := append(append([]byte{}, s.salt...), nonce...)
+	out = aead.Seal(out, nonce, []byte(plaintext), nil)
+	return SecretPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+func (s *SecretBox) Decrypt(value string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(value, SecretPrefix)))
+	if err != nil {
+		return "", errors.WithMessage(err, "decode secret")
+	}
+	if len(b) < secretSaltSize+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return "", errors.New("secret is too short")
+	}
+	key, err := s.key(b[:secretSaltSize])
+	if err != nil {
+		return "", err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := b[secretSaltSize : secretSaltSize+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, b[secretSaltSize+aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("decrypt secret: wrong master key or passphrase")
+	}
+	return string(plaintext), nil
+}
+
+// master secret is $SSHW_MASTER_PASSPHRASE, or content of MasterKeyPath
+func ReadMasterSecret() ([]byte, error) {
+	if passphrase := os.Getenv(EnvMasterPassphrase); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	b, err := ioutil.ReadFile(MasterKeyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("master key %s does not exist, set %s or run `sshw secret encrypt`", MasterKeyPath, EnvMasterPassphrase)
+		}
+		return nil, errors.WithMessage(err, "read master key")
+	}
+	return bytes.TrimSpace(b), nil
+}
+
+// generate random master key into filename
+func GenerateMasterKey(filename string) ([]byte, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	key := []byte(base64.StdEncoding.EncodeToString(raw))
+	if err := os.MkdirAll(path.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filename, append(key, '\n'), 0600); err != nil {
+		return nil, errors.WithMessage(err, "write master key")
+	}
+	return key, nil
+}
+
+// secret box of master secret, it is loaded at first encrypted field
+func DefaultSecretBox() (*SecretBox, error) {
+	defaultSecretBoxLock.Lock()
+	defer defaultSecretBoxLock.Unlock()
+	if defaultSecretBox != nil {
+		return defaultSecretBox, nil
+	}
+	master, err := ReadMasterSecret()
+	if err != nil {
+		return nil, err
+	}
+	box, err := NewSecretBox(master)
+	if err != nil {
+		return nil, err
+	}
+	defaultSecretBox = box
+	return box, nil
+}
+
+// decrypt enc: fields of node, etc. password, passphrase and answers
+// it is done for the node to connect only, other commands do not need master secret
+// children and jump nodes are decrypted by their own clients
+func DecryptNodeSecrets(node *Node) error {
+	var decryptErr error
+	if err := WalkInterface(reflect.ValueOf(node), false, func(k string, t reflect.Type, v reflect.Value, structField *reflect.StructField) (stop bool) {
+		if decryptErr != nil || t == nodeType {
+			return true
+		}
+		if t.Kind() != reflect.String || !v.CanSet() || !IsEncrypted(v.String()) {
+			return
+		}
+		plaintext, err := DecryptSecret(v.String())
+		if err != nil {
+			decryptErr = errors.WithMessage(err, k)
+			return true
+		}
+		v.SetString(plaintext)
+		return
+	}); err != nil {
+		return err
+	}
+	return decryptErr
+}
+
+func DecryptSecret(value string) (string, error) {
+	box, err := DefaultSecretBox()
+	if err != nil {
+		return "", err
+	}
+	return box.Decrypt(value)
+}
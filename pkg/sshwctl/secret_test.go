@@ -0,0 +1,94 @@
+package sshwctl
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func TestSecretBox(t *testing.T) {
+	ast := assert.New(t)
+	box, err := NewSecretBox([]byte("master"))
+	ast.Nil(err)
+	encrypted, err := box.Encrypt("device-password")
+	ast.Nil(err)
+	ast.True(IsEncrypted(encrypted))
+	ast.NotContains(encrypted, "device-password")
+
+	// another process derives key from salt in value
+	another, _ := NewSecretBox([]byte("master"))
+	plaintext, err := another.Decrypt(encrypted)
+	ast.Nil(err)
+	ast.Equal("device-password", plaintext)
+
+	wrong, _ := NewSecretBox([]byte("wrong"))
+	_, err = wrong.Decrypt(encrypted)
+	ast.NotNil(err)
+
+	_, err = box.Decrypt("enc:c2hvcnQ=")
+	ast.NotNil(err)
+}
+
+func Test_rewriteSecretTag(t *testing.T) {
+	ast := assert.New(t)
+	ast.Equal("password: enc:abc=\n", string(rewriteSecretTag([]byte("password: !encrypted abc=\n"))))
+	ast.Equal("- answer: enc:abc=\n", string(rewriteSecretTag([]byte("- answer: !encrypted \"abc=\"\n"))))
+	ast.Equal("name: '!encrypted'\n", string(rewriteSecretTag([]byte("name: '!encrypted'\n"))))
+	ast.Equal("password: enc:abcdef=\n", string(rewriteSecretTag([]byte("password: !encrypted |\n  abc\n  def=\n"))))
+	ast.Equal("a: {password: 'enc:abc='}\n", string(rewriteSecretTag([]byte("a: {password: !encrypted abc=}\n"))))
+}
+
+func TestInitConfigDecrypt(t *testing.T) {
+	ast := assert.New(t)
+	_ = os.Setenv(EnvMasterPassphrase, "master")
+	defer os.Unsetenv(EnvMasterPassphrase)
+	defaultSecretBox = nil
+	defer func() {
+		defaultSecretBox = nil
+	}()
+
+	box, _ := NewSecretBox([]byte("master"))
+	encrypted, _ := box.Encrypt("secret")
+	nodes, err := LoadYamlConfig0([]byte(`
+- name: tag
+  password: !encrypted ` + strings.TrimPrefix(encrypted, SecretPrefix) + `
+- name: prefix
+  password: ` + encrypted + `
+`))
+	ast.Nil(err)
+	ast.Nil(InitConfig(nodes))
+	// ciphertext is kept until node is connected
+	ast.Equal(encrypted, nodes[1].Password)
+	ast.Nil(DecryptNodeSecrets(nodes[0]))
+	ast.Nil(DecryptNodeSecrets(nodes[1]))
+	ast.Equal("secret", nodes[0].Password)
+	ast.Equal("secret", nodes[1].Password)
+
+	// wrong master secret breaks the node to connect only
+	defaultSecretBox = nil
+	_ = os.Setenv(EnvMasterPassphrase, "wrong")
+	wrong := []*Node{{Name: "wrong", Password: encrypted, Children: []*Node{{Name: "child", KeyboardInteractions: []KeyboardInteractive{{Answer: encrypted}}}}}}
+	ast.Nil(InitConfig(wrong))
+	ast.NotNil(DecryptNodeSecrets(wrong[0]))
+	ast.NotNil(DecryptNodeSecrets(wrong[0].Children[0]))
+	ast.Equal(encrypted, wrong[0].Children[0].KeyboardInteractions[0].Answer)
+}
+
+func TestYamlDocuments(t *testing.T) {
+	ast := assert.New(t)
+	src := "# comment\n- name: a\n  password: plain\n  children:\n    - name: b\n      passphrase: other\n"
+	documents, err := ParseYamlDocuments([]byte(src))
+	ast.Nil(err)
+	var keys []string
+	ast.Nil(documents.WalkScalars(func(key string, value *yamlv3.Node) error {
+		keys = append(keys, key+"="+value.Value)
+		return nil
+	}))
+	ast.Equal([]string{"name=a", "password=plain", "name=b", "passphrase=other"}, keys)
+	b, err := documents.Bytes()
+	ast.Nil(err)
+	ast.Equal(src, string(b))
+}
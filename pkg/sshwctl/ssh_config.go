@@ -0,0 +1,430 @@
+package sshwctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const maxSshConfigDepth = 16
+
+// options of ssh_config that sshw understands, others are warned and ignored
+var sshConfigOptions = map[string]bool{
+	"hostname":              true,
+	"port":                  true,
+	"user":                  true,
+	"identityfile":          true,
+	"proxyjump":             true,
+	"proxycommand":          true,
+	"localforward":          true,
+	"remoteforward":         true,
+	"serveraliveinterval":   true,
+	"serveralivecountmax":   true,
+	"stricthostkeychecking": true,
+	"userknownhostsfile":    true,
+	"certificatefile":       true,
+}
+
+// options that can be specified multiple times
+var sshConfigMultiOptions = map[string]bool{
+	"identityfile":    true,
+	"localforward":    true,
+	"remoteforward":   true,
+	"certificatefile": true,
+}
+
+type sshConfigOption struct {
+	key   string
+	value string
+}
+
+// Host or Match block
+type sshConfigBlock struct {
+	// patterns of Host
+	patterns string
+	// criteria of Match, nil if block is Host
+	criteria []string
+	options  []*sshConfigOption
+}
+
+type SshConfig struct {
+	blocks   []*sshConfigBlock
+	Warnings []string
+	// directory of relative Include
+	dir string
+}
+
+func ParseSshConfig(r io.Reader, dir string) (*SshConfig, error) {
+	c := &SshConfig{dir: dir}
+	// options before first Host apply to all hosts
+	c.blocks = append(c.blocks, &sshConfigBlock{patterns: "*"})
+	if err := c.parse(r, "ssh config", 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *SshConfig) warn(format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (c *SshConfig) parse(r io.Reader, filename string, depth int) error {
+	if depth > maxSshConfigDepth {
+		return errors.Errorf("%s: too many nested Include", filename)
+	}
+	warned := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		key, value := splitSshConfigLine(scanner.Text())
+		if key == "" {
+			continue
+		}
+		block := c.blocks[len(c.blocks)-1]
+		switch key {
+		case "host":
+			c.blocks = append(c.blocks, &sshConfigBlock{patterns: value})
+		case "match":
+			criteria := strings.Fields(value)
+			if len(criteria) == 0 {
+				return errors.Errorf("%s line %d: Match needs criteria", filename, lineNum)
+			}
+			for i := 0; i < len(criteria); i++ {
+				criterion := strings.TrimPrefix(strings.ToLower(criteria[i]), "!")
+				switch criterion {
+				case "all":
+				case "host", "originalhost", "user", "localuser":
+					i++
+				case "exec", "localnetwork", "tagged":
+					i++
+					c.warn("%s line %d: unsupported Match %s, the block is ignored", filename, lineNum, criterion)
+				default:
+					c.warn("%s line %d: unsupported Match %s, the block is ignored", filename, lineNum, criterion)
+				}
+			}
+			c.blocks = append(c.blocks, &sshConfigBlock{criteria: criteria})
+		case "include":
+			count := len(c.blocks)
+			for _, include := range strings.Fields(value) {
+				if err := c.include(include, depth); err != nil {
+					return errors.WithMessage(err, fmt.Sprintf("%s line %d", filename, lineNum))
+				}
+			}
+			// options after Include belong to current block, not the last block of included file
+			if len(c.blocks) != count {
+				c.blocks = append(c.blocks, &sshConfigBlock{patterns: block.patterns, criteria: block.criteria})
+			}
+		default:
+			if !sshConfigOptions[key] {
+				if !warned[key] {
+					warned[key] = true
+					c.warn("%s line %d: unsupported option %s is ignored", filename, lineNum, key)
+				}
+				continue
+			}
+			block.options = append(block.options, &sshConfigOption{key: key, value: value})
+		}
+	}
+	return scanner.Err()
+}
+
+// options of included file outside of Host belong to current block
+func (c *SshConfig) include(include string, depth int) error {
+	p := include
+	if strings.HasPrefix(p, "~") {
+		p = path.Join(homeDir, p[1:])
+	} else if !filepath.IsAbs(p) {
+		p = filepath.Join(c.dir, p)
+	}
+	matches, err := filepath.Glob(p)
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		b, err := ioutil.ReadFile(match)
+		if err != nil {
+			return err
+		}
+		if err := c.parse(strings.NewReader(string(b)), match, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// return lower key and value, `Key Value` or `Key=Value`
+func splitSshConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	key := strings.ToLower(line[:i])
+	value := strings.TrimSpace(line[i:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return key, value
+}
+
+// aliases of Host without wildcard and negation, in order
+func (c *SshConfig) Aliases() []string {
+	var aliases []string
+	seen := make(map[string]bool)
+	for _, block := range c.blocks[1:] {
+		if block.criteria != nil {
+			continue
+		}
+		for _, pattern := range splitPatterns(block.patterns) {
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			aliases = append(aliases, pattern)
+		}
+	}
+	return aliases
+}
+
+// options of alias like ssh, the first obtained value wins
+func (c *SshConfig) Resolve(alias string) map[string][]string {
+	options := make(map[string][]string)
+	for _, block := range c.blocks {
+		if block.criteria != nil {
+			if !c.matchCriteria(alias, block.criteria, options) {
+				continue
+			}
+		} else if !MatchHostPatterns(alias, block.patterns) {
+			continue
+		}
+		for _, option := range block.options {
+			if _, has := options[option.key]; has && !sshConfigMultiOptions[option.key] {
+				continue
+			}
+			options[option.key] = append(options[option.key], option.value)
+		}
+	}
+	return options
+}
+
+// Match host, originalhost, user, localuser and all, other criteria never match
+func (c *SshConfig) matchCriteria(alias string, criteria []string, options map[string][]string) bool {
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	for i := 0; i < len(criteria); i++ {
+		criterion := strings.ToLower(criteria[i])
+		negate := strings.HasPrefix(criterion, "!")
+		criterion = strings.TrimPrefix(criterion, "!")
+		var matched bool
+		switch criterion {
+		case "all":
+			matched = true
+		case "host", "originalhost", "user", "localuser":
+			if i+1 >= len(criteria) {
+				return false
+			}
+			i++
+			var target string
+			switch criterion {
+			case "host":
+				target = alias
+				if hostName := options["hostname"]; len(hostName) != 0 {
+					target = hostName[0]
+				}
+			case "originalhost":
+				target = alias
+			case "user":
+				target = localUser
+				if u := options["user"]; len(u) != 0 {
+					target = u[0]
+				}
+			case "localuser":
+				target = localUser
+			}
+			matched = MatchHostPatterns(target, criteria[i])
+		default:
+			return false
+		}
+		if matched == negate {
+			return false
+		}
+	}
+	return true
+}
+
+// node of alias, ProxyJump of aliases in config are resolved too
+func (c *SshConfig) Node(alias string) (*Node, error) {
+	return c.node(alias, 0)
+}
+
+func (c *SshConfig) node(alias string, depth int) (*Node, error) {
+	if depth > maxSshConfigDepth {
+		return nil, errors.Errorf("%s: ProxyJump loop", alias)
+	}
+	options := c.Resolve(alias)
+	first := func(key string) string {
+		if values := options[key]; len(values) != 0 {
+			return values[0]
+		}
+		return ""
+	}
+	node := &Node{Name: alias, Alias: alias, Host: first("hostname"), User: first("user")}
+	if node.Host == "" {
+		node.Host = alias
+	}
+	if port := first("port"); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, errors.Errorf("%s: invalid Port %s", alias, port)
+		}
+		node.Port = p
+	}
+	expand := func(s string) string {
+		return expandSshTokens(s, alias, node)
+	}
+	for i, identityFile := range options["identityfile"] {
+		if i == 0 {
+			node.KeyPath = expandSshPath(expand(identityFile))
+		} else {
+			node.IdentityFiles = append(node.IdentityFiles, expandSshPath(expand(identityFile)))
+		}
+	}
+	if certificateFile := first("certificatefile"); certificateFile != "" {
+		node.CertificateFile = expandSshPath(expand(certificateFile))
+	}
+	if proxyCommand := first("proxycommand"); proxyCommand != "" && strings.ToLower(proxyCommand) != "none" {
+		// tokens are expanded when dialing
+		node.ProxyCommand = proxyCommand
+	}
+	node.LocalForward = options["localforward"]
+	node.RemoteForward = options["remoteforward"]
+	if interval := first("serveraliveinterval"); interval != "" {
+		seconds, err := strconv.Atoi(interval)
+		if err != nil {
+			return nil, errors.Errorf("%s: invalid ServerAliveInterval %s", alias, interval)
+		}
+		node.ServerAliveInterval = time.Duration(seconds) * time.Second
+	}
+	if countMax := first("serveralivecountmax"); countMax != "" {
+		count, err := strconv.Atoi(countMax)
+		if err != nil {
+			return nil, errors.Errorf("%s: invalid ServerAliveCountMax %s", alias, countMax)
+		}
+		node.ServerAliveCountMax = count
+	}
+	node.StrictHostKeyChecking = strings.ToLower(first("stricthostkeychecking"))
+	if knownHostsFile := first("userknownhostsfile"); knownHostsFile != "" {
+		node.UserKnownHostsFile = expandSshPath(strings.Fields(expand(knownHostsFile))[0])
+	}
+
+	if proxyJump := first("proxyjump"); proxyJump != "" && strings.ToLower(proxyJump) != "none" {
+		for _, hop := range strings.Split(proxyJump, ",") {
+			jumps, err := c.jumpNodes(strings.TrimSpace(hop), depth)
+			if err != nil {
+				return nil, errors.WithMessage(err, alias)
+			}
+			node.Jump = append(node.Jump, jumps...)
+		}
+	}
+	return node, nil
+}
+
+// [user@]host[:port], host may be an alias in config
+// ProxyJump of the hop goes before it, jumps are dialed in order, loop is stopped by depth
+func (c *SshConfig) jumpNodes(hop string, depth int) ([]*Node, error) {
+	var hopUser string
+	if i := strings.LastIndex(hop, "@"); i >= 0 {
+		hopUser, hop = hop[:i], hop[i+1:]
+	}
+	host, port := hop, ""
+	if i := strings.LastIndex(hop, ":"); i >= 0 && !strings.HasSuffix(hop, "]") {
+		host, port = hop[:i], hop[i+1:]
+	}
+	host = strings.Trim(host, "[]")
+	node, err := c.node(host, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	// jumps of hop are resolved recursively, the chain is flat
+	chain := node.Jump
+	node.Jump = nil
+	if hopUser != "" {
+		node.User = hopUser
+	}
+	if port != "" {
+		if node.Port, err = strconv.Atoi(port); err != nil {
+			return nil, errors.Errorf("invalid ProxyJump %s", hop)
+		}
+	}
+	return append(chain, node), nil
+}
+
+// %h host, %p port, %r user, %n alias, %d home, %% percent
+func expandSshTokens(s, alias string, node *Node) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", node.Host,
+		"%p", node.portStr(),
+		"%r", node.user(),
+		"%n", alias,
+		"%d", homeDir,
+	).Replace(s)
+}
+
+func expandSshPath(p string) string {
+	if strings.HasPrefix(p, "~") {
+		return path.Join(homeDir, p[1:])
+	}
+	return p
+}
+
+type SshConfigLoader struct {
+	r io.Reader
+	// warnings of unsupported options
+	Warn io.Writer
+}
+
+func NewSshConfigLoader(r io.Reader) ConfigLoader {
+	return &SshConfigLoader{r: r}
+}
+
+func (s *SshConfigLoader) Decode(nodes *[]*Node) error {
+	cfg, err := ParseSshConfig(s.r, path.Dir(SshPath))
+	if err != nil {
+		return errors.WithMessage(err, "load ssh")
+	}
+	for _, warning := range cfg.Warnings {
+		if s.Warn != nil {
+			_, _ = fmt.Fprintln(s.Warn, "sshw: "+warning)
+		}
+	}
+	for _, alias := range cfg.Aliases() {
+		node, err := cfg.Node(alias)
+		if err != nil {
+			return errors.WithMessage(err, "load ssh")
+		}
+		*nodes = append(*nodes, node)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package sshwctl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSshConfigLoader_Decode(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	sshPath := SshPath
+	SshPath = path.Join(dir, "config")
+	defer func() {
+		SshPath = sshPath
+	}()
+	_ = os.MkdirAll(path.Join(dir, "config.d"), 0755)
+	_ = ioutil.WriteFile(path.Join(dir, "config.d", "work"), []byte(`
+Host bastion
+  HostName bastion.example.com
+  User jump
+  Port 2222
+`), 0644)
+
+	config := `
+Include config.d/*
+ForwardAgent yes
+
+Host web db
+  HostName %h.internal
+  ProxyJump bastion,admin@10.0.0.1:22
+  LocalForward 8080 localhost:80
+  LocalForward 127.0.0.1:5432 db:5432
+  ServerAliveInterval 30
+  StrictHostKeyChecking accept-new
+  CertificateFile ~/.ssh/id_ed25519-cert.pub
+
+Host legacy
+  ProxyCommand nc %h %p
+  IdentityFile ~/.ssh/legacy
+
+Match host db.internal user root
+  Port 2200
+
+Match exec "true"
+  Port 1
+
+Host *
+  User root
+  IdentityFile ~/.ssh/default
+`
+	warn := bytes.NewBuffer(nil)
+	var nodes []*Node
+	loader := &SshConfigLoader{r: strings.NewReader(config), Warn: warn}
+	ast.Nil(loader.Decode(&nodes))
+	ast.Contains(warn.String(), "unsupported option forwardagent")
+	ast.Contains(warn.String(), "unsupported Match exec")
+
+	ast.Len(nodes, 4)
+	bastion, web, db, legacy := nodes[0], nodes[1], nodes[2], nodes[3]
+	ast.Equal("bastion.example.com", bastion.Host)
+	ast.Equal("jump", bastion.User)
+	ast.Equal(2222, bastion.Port)
+
+	ast.Equal("web", web.Name)
+	ast.Equal("%h.internal", web.Host)
+	ast.Equal("root", web.User)
+	ast.Equal(path.Join(homeDir, ".ssh/default"), web.KeyPath)
+	ast.Len(web.Jump, 2)
+	ast.Equal("bastion.example.com", web.Jump[0].Host)
+	ast.Equal("jump", web.Jump[0].User)
+	ast.Equal("10.0.0.1", web.Jump[1].Host)
+	ast.Equal("admin", web.Jump[1].User)
+	ast.Equal(22, web.Jump[1].Port)
+	ast.Equal([]string{"8080 localhost:80", "127.0.0.1:5432 db:5432"}, web.LocalForward)
+	ast.Equal(30*time.Second, web.ServerAliveInterval)
+	ast.Equal(StrictHostKeyCheckingAcceptNew, web.StrictHostKeyChecking)
+	ast.Equal(path.Join(homeDir, ".ssh/id_ed25519-cert.pub"), web.CertificateFile)
+	ast.Equal(0, web.Port)
+
+	ast.Equal("db", db.Name)
+	ast.Equal("legacy", legacy.Host)
+	ast.Equal("nc %h %p", legacy.ProxyCommand)
+	ast.Equal(path.Join(homeDir, ".ssh/legacy"), legacy.KeyPath)
+}
+
+func TestSshConfig_Match(t *testing.T) {
+	ast := assert.New(t)
+	cfg, err := ParseSshConfig(strings.NewReader(`
+Host db
+  HostName db.internal
+  User root
+
+Match host db.internal user root
+  Port 2200
+
+Match originalhost web !user admin
+  Port 2300
+`), "")
+	ast.Nil(err)
+	db, err := cfg.Node("db")
+	ast.Nil(err)
+	ast.Equal(2200, db.Port)
+	web, err := cfg.Node("web")
+	ast.Nil(err)
+	ast.Equal(2300, web.Port)
+}
+
+func TestSshConfig_OptionsAfterInclude(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	_ = ioutil.WriteFile(path.Join(dir, "work"), []byte(`
+Host bastion
+  HostName bastion.example.com
+`), 0644)
+	cfg, err := ParseSshConfig(strings.NewReader(`
+Include work
+User root
+
+Host web
+  Include work
+  Port 2200
+`), dir)
+	ast.Nil(err)
+	bastion, err := cfg.Node("bastion")
+	ast.Nil(err)
+	ast.Equal("bastion.example.com", bastion.Host)
+	ast.Equal("root", bastion.User)
+	ast.Equal(0, bastion.Port)
+	web, err := cfg.Node("web")
+	ast.Nil(err)
+	ast.Equal("root", web.User)
+	ast.Equal(2200, web.Port)
+	ast.Equal([]string{"bastion", "web"}, cfg.Aliases())
+}
+
+func TestSshConfig_ProxyJumpChain(t *testing.T) {
+	ast := assert.New(t)
+	cfg, err := ParseSshConfig(strings.NewReader(`
+Host a
+  ProxyJump c
+Host b
+  ProxyJump d
+Host target
+  ProxyJump a,b
+  IdentityFile ~/.ssh/first
+  IdentityFile ~/.ssh/second
+Host loop
+  ProxyJump loop
+`), "")
+	ast.Nil(err)
+	target, err := cfg.Node("target")
+	ast.Nil(err)
+	var hops []string
+	for _, jump := range target.Jump {
+		hops = append(hops, jump.Host)
+		ast.Len(jump.Jump, 0)
+	}
+	// jumps of every hop go before it
+	ast.Equal([]string{"c", "a", "d", "b"}, hops)
+	ast.Equal(path.Join(homeDir, ".ssh/first"), target.KeyPath)
+	ast.Equal([]string{path.Join(homeDir, ".ssh/second")}, target.IdentityFiles)
+
+	_, err = cfg.Node("loop")
+	ast.NotNil(err)
+	ast.Contains(err.Error(), "ProxyJump loop")
+}
+
+func TestParseForward(t *testing.T) {
+	ast := assert.New(t)
+	forward, err := ParseForward("8080 localhost:80")
+	ast.Nil(err)
+	ast.Equal(&Forward{Listen: "localhost:8080", Target: "localhost:80"}, forward)
+	forward, err = ParseForward("0.0.0.0:5432 db:5432")
+	ast.Nil(err)
+	ast.Equal(&Forward{Listen: "0.0.0.0:5432", Target: "db:5432"}, forward)
+	_, err = ParseForward("8080")
+	ast.NotNil(err)
+	_, err = ParseForward("8080 db")
+	ast.NotNil(err)
+}
@@ -0,0 +1,248 @@
+package sshwctl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// checkout of team config repository, it is layered under personal config
+	TeamConfigDir = path.Join(SshwDir, "team")
+)
+
+// git repository of team config, written in settings of global config
+// etc. `sync: {repo: git@example.com:ops/sshw.git, verify-commit: true}`
+type SyncConfig struct {
+	// url or path of repository, local bare repository works offline
+	Repo string `yaml:"repo"`
+	// default is HEAD of repository
+	Branch string `yaml:"branch,omitempty"`
+	// commit is checked out only if `git verify-commit` passes
+	VerifyCommit bool `yaml:"verify-commit,omitempty"`
+}
+
+func GlobalSyncConfig() *SyncConfig {
+	if globalSettings.Sync == nil {
+		return new(SyncConfig)
+	}
+	c := *globalSettings.Sync
+	return &c
+}
+
+// *.yaml of team config
+func TeamConfigFiles() []string {
+	matches, _ := filepath.Glob(path.Join(TeamConfigDir, "*.yaml"))
+	sort.Strings(matches)
+	return matches
+}
+
+// clone repository into TeamConfigDir, or fast-forward it
+// output of git is written into out
+func Sync(c *SyncConfig, out io.Writer) error {
+	if c.Repo == "" {
+		return errors.New("repo of sync is not set")
+	}
+	if _, err := os.Stat(path.Join(TeamConfigDir, ".git")); os.IsNotExist(err) {
+		return c.clone(out)
+	}
+
+	if remote, err := gitOutput(TeamConfigDir, "remote", "get-url", "origin"); err == nil && remote != c.Repo {
+		if err := runGit(TeamConfigDir, out, "remote", "set-url", "origin", c.Repo); err != nil {
+			return err
+		}
+	}
+	if err := runGit(TeamConfigDir, out, "fetch", "--prune", "origin"); err != nil {
+		return err
+	}
+	branch, err := c.branch(TeamConfigDir)
+	if err != nil {
+		return err
+	}
+	if err := c.verify(TeamConfigDir, out, "origin/"+branch); err != nil {
+		return err
+	}
+	if current, _ := gitOutput(TeamConfigDir, "rev-parse", "--abbrev-ref", "HEAD"); current != branch {
+		return runGit(TeamConfigDir, out, "checkout", "-B", branch, "origin/"+branch)
+	}
+	return runGit(TeamConfigDir, out, "merge", "--ff-only", "origin/"+branch)
+}
+
+// clone into a temporary directory beside TeamConfigDir, it is renamed to TeamConfigDir after checkout
+// so a failed clone or verification leaves nothing behind
+func (c *SyncConfig) clone(out io.Writer) error {
+	if err := os.MkdirAll(path.Dir(TeamConfigDir), 0700); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(path.Dir(TeamConfigDir), "."+path.Base(TeamConfigDir)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := runGit("", out, "clone", "--no-checkout", "--origin", "origin", c.Repo, dir); err != nil {
+		return err
+	}
+	branch, err := c.branch(dir)
+	if err != nil {
+		return err
+	}
+	if err := c.verify(dir, out, "origin/"+branch); err != nil {
+		return err
+	}
+	if err := runGit(dir, out, "checkout", "-B", branch, "origin/"+branch); err != nil {
+		return err
+	}
+	// empty directory is replaced, like git clone into it
+	_ = os.Remove(TeamConfigDir)
+	return os.Rename(dir, TeamConfigDir)
+}
+
+// configured branch, or HEAD of origin
+func (c *SyncConfig) branch(dir string) (string, error) {
+	if c.Branch != "" {
+		return c.Branch, nil
+	}
+	head, err := gitOutput(dir, "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	if err != nil {
+		if err := runGit(dir, nil, "remote", "set-head", "origin", "--auto"); err != nil {
+			return "", errors.WithMessage(err, "branch of origin")
+		}
+		if head, err = gitOutput(dir, "symbolic-ref", "--short", "refs/remotes/origin/HEAD"); err != nil {
+			return "", errors.WithMessage(err, "branch of origin")
+		}
+	}
+	return strings.TrimPrefix(head, "origin/"), nil
+}
+
+func (c *SyncConfig) verify(dir string, out io.Writer, rev string) error {
+	if !c.VerifyCommit {
+		return nil
+	}
+	if err := runGit(dir, out, "verify-commit", rev); err != nil {
+		return errors.WithMessage(err, "verify commit "+rev)
+	}
+	return nil
+}
+
+// drift of team config
+type SyncStatus struct {
+	Branch string
+	// commit checked out
+	Local string
+	// commit of branch in repository, empty if it can not be reached
+	Remote string
+	// files changed in TeamConfigDir
+	Modified []string
+}
+
+func GetSyncStatus(c *SyncConfig) (*SyncStatus, error) {
+	if _, err := os.Stat(path.Join(TeamConfigDir, ".git")); err != nil {
+		return nil, errors.Errorf("%s is not synced, run `sshw sync`", TeamConfigDir)
+	}
+	status := new(SyncStatus)
+	var err error
+	if status.Branch, err = gitOutput(TeamConfigDir, "rev-parse", "--abbrev-ref", "HEAD"); err != nil {
+		return nil, err
+	}
+	if status.Local, err = gitOutput(TeamConfigDir, "rev-parse", "HEAD"); err != nil {
+		return nil, err
+	}
+	repo := c.Repo
+	if repo == "" {
+		repo = "origin"
+	}
+	if remote, err := gitOutput(TeamConfigDir, "ls-remote", repo, "refs/heads/"+status.Branch); err == nil {
+		if fields := strings.Fields(remote); len(fields) != 0 {
+			status.Remote = fields[0]
+		}
+	}
+	modified, err := gitOutput(TeamConfigDir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(modified, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			status.Modified = append(status.Modified, line)
+		}
+	}
+	return status, nil
+}
+
+// paths of team nodes replaced by personal nodes in LayerNodes
+func OverriddenNodes(team, personal []*Node) []string {
+	var paths []string
+	var walk func(team, personal []*Node, prefix string)
+	walk = func(team, personal []*Node, prefix string) {
+		for _, p := range personal {
+			if p.MergeIgnore {
+				continue
+			}
+			for _, t := range team {
+				if t.Name != p.Name {
+					continue
+				}
+				if IsBookmark(t) && IsBookmark(p) {
+					walk(t.Children, p.Children, joinNodePath(prefix, p.Name))
+				} else {
+					paths = append(paths, joinNodePath(prefix, p.Name))
+				}
+				break
+			}
+		}
+	}
+	walk(team, personal, "")
+	return paths
+}
+
+// load team config, its includes are resolved
+func LoadTeamConfig() ([]*Node, error) {
+	var nodes []*Node
+	for _, filename := range TeamConfigFiles() {
+		_, b, err := ReadConfigBytes(filename)
+		if err != nil {
+			return nil, err
+		}
+		teamNodes, err := loadIncludedYaml(filename, b, nil)
+		if err != nil {
+			return nil, err
+		}
+		LayerNodes(&nodes, teamNodes)
+	}
+	return nodes, nil
+}
+
+func runGit(dir string, out io.Writer, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stdout = out
+	cmd.Stderr = stderr
+	if out != nil {
+		cmd.Stderr = io.MultiWriter(out, stderr)
+	}
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf("git %s: %v %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	stdout := bytes.NewBuffer(nil)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = stdout
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Errorf("git %s: %v %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,93 @@
+package sshwctl
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSync(t *testing.T) {
+	ast := assert.New(t)
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	teamDir := TeamConfigDir
+	TeamConfigDir = path.Join(dir, "team")
+	defer func() {
+		TeamConfigDir = teamDir
+	}()
+
+	// bare repository and a working copy to push
+	bare, work := path.Join(dir, "team.git"), path.Join(dir, "work")
+	git := func(dir string, args ...string) {
+		args = append([]string{"-c", "user.name=sshw", "-c", "user.email=sshw@example.com", "-c", "commit.gpgsign=false"}, args...)
+		ast.Nil(runGit(dir, nil, args...))
+	}
+	git("", "init", "--bare", "--initial-branch=main", bare)
+	git("", "clone", bare, work)
+	commit := func(content string) {
+		ast.Nil(ioutil.WriteFile(path.Join(work, "team.yaml"), []byte(content), 0644))
+		git(work, "add", "-A")
+		git(work, "commit", "-m", "update")
+		git(work, "push", "origin", "HEAD:main")
+	}
+	commit("- name: prod\n  children:\n    - name: web\n      host: 10.0.0.1\n")
+
+	// failed clone leaves neither TeamConfigDir nor its temporary directory
+	ast.NotNil(Sync(&SyncConfig{Repo: bare, VerifyCommit: true}, nil))
+	_, statErr := os.Stat(TeamConfigDir)
+	ast.True(os.IsNotExist(statErr))
+	temps, _ := filepath.Glob(path.Join(dir, ".team-*"))
+	ast.Empty(temps)
+
+	c := &SyncConfig{Repo: bare}
+	ast.Nil(Sync(c, nil))
+	nodes, err := LoadTeamConfig()
+	ast.Nil(err)
+	ast.Equal("10.0.0.1", nodes[0].Children[0].Host)
+
+	commit("- name: prod\n  children:\n    - name: web\n      host: 10.0.0.2\n    - name: db\n      host: 10.0.0.3\n")
+	status, err := GetSyncStatus(c)
+	ast.Nil(err)
+	ast.Equal("main", status.Branch)
+	ast.NotEqual(status.Local, status.Remote)
+
+	ast.Nil(Sync(c, nil))
+	status, err = GetSyncStatus(c)
+	ast.Nil(err)
+	ast.Equal(status.Local, status.Remote)
+	ast.Empty(status.Modified)
+
+	// unsigned commit is rejected
+	commit("- name: prod\n")
+	c.VerifyCommit = true
+	ast.NotNil(Sync(c, nil))
+	nodes, err = LoadTeamConfig()
+	ast.Nil(err)
+	ast.Len(nodes[0].Children, 2)
+
+	// personal config overrides team config
+	personal := []*Node{{Name: "prod", Children: []*Node{{Name: "web", Host: "127.0.0.1"}}}}
+	ast.Equal([]string{"prod/web"}, OverriddenNodes(nodes, personal))
+	filename := path.Join(dir, "sshw.yaml")
+	_ = ioutil.WriteFile(filename, []byte("- name: prod\n  children:\n    - name: web\n      host: 127.0.0.1\n"), 0644)
+	_, nodes, err = LoadYamlConfigs(filename)
+	ast.Nil(err)
+	ast.Len(nodes[0].Children, 2)
+	ast.Equal("127.0.0.1", nodes[0].Children[0].Host)
+	ast.Equal("db", nodes[0].Children[1].Name)
+
+	// broken team config is skipped
+	_ = ioutil.WriteFile(path.Join(TeamConfigDir, "team.yaml"), []byte("- name: [prod\n"), 0644)
+	_, nodes, err = LoadYamlConfigs(filename)
+	ast.Nil(err)
+	ast.Len(nodes[0].Children, 1)
+	ast.Equal("127.0.0.1", nodes[0].Children[0].Host)
+}
@@ -2,9 +2,10 @@ package sshwctl
 
 import (
 	"bytes"
-	"os"
 	"strings"
 	"text/scanner"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -16,41 +17,47 @@ type CustomTemplate struct {
 	Templates []*TemplateNode
 }
 
+// render template, missing value is written as origin str
 func (c *CustomTemplate) Execute() string {
+	r, _ := c.ExecuteContext(nil)
+	return r
+}
+
+// render template with node of ctx, ctx can be nil
+// For example:
+// ${ENV1,ENV2:default}        first var of node or not empty env, or default, or origin str
+// ${env:ENV1,ENV2:default}    same as above, but it is error if nothing found
+// ${file:~/.secrets/db}       content of file
+// ${exec:pass show db}        stdout of shell command, cached in process
+// ${node:Host}                other field of node, go name or yaml name
+// ${item:data.ip}             field of inventory item, see inventory.go
+// ${file:~/.secrets/db | trim | lower}    filters are applied from left to right
+// the first error is returned, and origin str is written instead
+func (c *CustomTemplate) ExecuteContext(ctx *TemplateContext) (string, error) {
+	var e error
 	builder := strings.Builder{}
-TEMPLATE:
 	for i := range c.Templates {
 		templateNode := c.Templates[i]
 		switch templateNode.Type {
 		case TypeStr:
 			builder.WriteString(templateNode.Value)
 		case TypeParam:
-			s := templateNode.Value[2 : len(templateNode.Value)-1]
-			if len(s) == 0 {
-				builder.WriteString(templateNode.Value)
-				continue
-			}
-			spiltColon := strings.SplitN(s, ":", 2)
-			envKeys := spiltColon[0]
-			splitComma := strings.Split(envKeys, ",")
-			for i := range splitComma {
-				envKey := splitComma[i]
-				envValue := os.Getenv(envKey)
-				if envValue != "" {
-					builder.WriteString(envValue)
-					continue TEMPLATE
+			v, found, err := ctx.resolve(templateNode.Value[2 : len(templateNode.Value)-1])
+			if err != nil {
+				if e == nil {
+					e = errors.WithMessage(err, "template "+templateNode.Value)
 				}
+				found = false
 			}
-			if len(spiltColon) != 1 {
-				defaultValue := spiltColon[1]
-				builder.WriteString(defaultValue)
+			if !found {
+				// if and when can not find value, write origin str
+				builder.WriteString(templateNode.Value)
 				continue
 			}
-			// if and when can not find value, write origin str
-			builder.WriteString(templateNode.Value)
+			builder.WriteString(v)
 		}
 	}
-	return builder.String()
+	return builder.String(), e
 }
 
 type TemplateNode struct {
@@ -0,0 +1,225 @@
+package sshwctl
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const maxTemplateDepth = 8
+
+// a source resolves expression after `prefix:`
+type templateSource func(ctx *TemplateContext, expr string) (string, error)
+
+type templateFilter func(string) (string, error)
+
+var (
+	templateFilters = map[string]templateFilter{
+		"lower": func(s string) (string, error) { return strings.ToLower(s), nil },
+		"upper": func(s string) (string, error) { return strings.ToUpper(s), nil },
+		"trim":  func(s string) (string, error) { return strings.TrimSpace(s), nil },
+		"base64decode": func(s string) (string, error) {
+			b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+			return string(b), err
+		},
+		"base64encode": func(s string) (string, error) { return base64.StdEncoding.EncodeToString([]byte(s)), nil },
+	}
+)
+
+// stdout of ${exec:xxx}, { [command]: [stdout] }
+// one cache is shared by a rendering, etc. loading config or resolving the node to connect
+// so daemon runs commands again for every connection, rotated passwords are read
+type execCache struct {
+	sync.Mutex
+	values map[string]string
+}
+
+func newExecCache() *execCache {
+	return &execCache{values: make(map[string]string)}
+}
+
+// context of rendering fields of a node
+type TemplateContext struct {
+	Node *Node
+	// depth of ${node:xxx} references
+	depth int
+	// item of inventory, read by ${item:xxx}
+	item interface{}
+	// exec and file sources are not run, the field is resolved when node is connected, see ResolveNode
+	lazy  bool
+	execs *execCache
+}
+
+var errLazySource = errors.New("source is resolved when node is connected")
+
+func NewTemplateContext(node *Node) *TemplateContext {
+	return &TemplateContext{Node: node, execs: newExecCache()}
+}
+
+// resolve expression between `${` and `}`
+// found is false if legacy env expression has no value
+func (ctx *TemplateContext) resolve(expr string) (value string, found bool, err error) {
+	if expr == "" {
+		return "", false, nil
+	}
+	// peel known filters from right, `|` may be part of exec command
+	var filters []templateFilter
+	parts := strings.Split(expr, "|")
+	for len(parts) > 1 {
+		filter, has := templateFilters[strings.TrimSpace(parts[len(parts)-1])]
+		if !has {
+			break
+		}
+		filters = append([]templateFilter{filter}, filters...)
+		parts = parts[:len(parts)-1]
+	}
+	if len(filters) != 0 {
+		expr = strings.TrimSpace(strings.Join(parts, "|"))
+	}
+
+	if kv := strings.SplitN(expr, ":", 2); len(kv) == 2 {
+		if source := lookupTemplateSource(kv[0]); source != nil {
+			if ctx != nil && ctx.lazy && (kv[0] == "exec" || kv[0] == "file") {
+				return "", false, errLazySource
+			}
+			if value, err = source(ctx, kv[1]); err != nil {
+				return "", false, err
+			}
+			found = true
+		}
+	}
+	if !found {
+		if value, found = lookupVar(ctx, expr); !found {
+			return "", false, nil
+		}
+	}
+
+	for _, filter := range filters {
+		if value, err = filter(value); err != nil {
+			return "", false, err
+		}
+	}
+	return value, true, nil
+}
+
+func lookupTemplateSource(prefix string) templateSource {
+	switch prefix {
+	case "env":
+		return envSource
+	case "file":
+		return fileSource
+	case "exec":
+		return execSource
+	case "node":
+		return nodeSource
+	case "item":
+		return itemSource
+	}
+	return nil
+}
+
+// ENV1,ENV2:default, var of node is read before env
+func lookupVar(ctx *TemplateContext, expr string) (string, bool) {
+	spiltColon := strings.SplitN(expr, ":", 2)
+	for _, envKey := range strings.Split(spiltColon[0], ",") {
+		if ctx != nil && ctx.Node != nil {
+			if v, has := ctx.Node.Var(envKey); has {
+				return v, true
+			}
+		}
+		if envValue := os.Getenv(envKey); envValue != "" {
+			return envValue, true
+		}
+	}
+	if len(spiltColon) != 1 {
+		return spiltColon[1], true
+	}
+	return "", false
+}
+
+func envSource(ctx *TemplateContext, expr string) (string, error) {
+	if value, found := lookupVar(ctx, expr); found {
+		return value, nil
+	}
+	return "", errors.Errorf("env %s is empty", expr)
+}
+
+// content of file without trailing newline
+func fileSource(ctx *TemplateContext, expr string) (string, error) {
+	filename := strings.TrimSpace(expr)
+	if filename == "" {
+		return "", errors.New("file is empty")
+	}
+	b, err := ioutil.ReadFile(AbsPath(filename))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// stdout of command without trailing newline, command runs once in cache of ctx
+func execSource(ctx *TemplateContext, expr string) (string, error) {
+	command := strings.TrimSpace(expr)
+	if command == "" {
+		return "", errors.New("command is empty")
+	}
+	cache := newExecCache()
+	if ctx != nil && ctx.execs != nil {
+		cache = ctx.execs
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	if value, has := cache.values[command]; has {
+		return value, nil
+	}
+	cmd := exec.Command(Shell(), "-c", command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(string(out), "\r\n")
+	cache.values[command] = value
+	return value, nil
+}
+
+// other field of the same node, etc. Host or host
+func nodeSource(ctx *TemplateContext, expr string) (string, error) {
+	name := strings.TrimSpace(expr)
+	if ctx == nil || ctx.Node == nil {
+		return "", errors.Errorf("field %s: no node", name)
+	}
+	if ctx.depth >= maxTemplateDepth {
+		return "", errors.Errorf("field %s: reference cycle", name)
+	}
+	v := reflect.ValueOf(ctx.Node).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		yamlName := strings.SplitN(field.Tag.Get("yaml"), ",", 2)[0]
+		if field.Name != name && yamlName != name {
+			continue
+		}
+		value := v.Field(i)
+		switch value.Kind() {
+		case reflect.String:
+			s := value.String()
+			if !strings.Contains(s, "${") || ctx.Node.Verbatim[field.Name] {
+				return s, nil
+			}
+			// field may be rendered later
+			return ParseSshwTemplate(s).ExecuteContext(&TemplateContext{Node: ctx.Node, depth: ctx.depth + 1, lazy: ctx.lazy, execs: ctx.execs})
+		case reflect.Int, reflect.Int64, reflect.Bool:
+			return fmt.Sprint(value.Interface()), nil
+		}
+		return "", errors.Errorf("field %s is not scalar", name)
+	}
+	return "", errors.Errorf("node has no field %s", name)
+}
@@ -1,9 +1,14 @@
 package sshwctl
 
 import (
+	"io/ioutil"
 	"os"
+	"path"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestParseSshwTemplate(t *testing.T) {
@@ -86,3 +91,92 @@ func TestParseSshwTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomTemplate_ExecuteContext(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	secret := path.Join(dir, "secret")
+	_ = ioutil.WriteFile(secret, []byte("  DB-Password\n"), 0600)
+	_ = os.Setenv("SSHW_TEMPLATE_ENV", "Value")
+	defer os.Unsetenv("SSHW_TEMPLATE_ENV")
+	ctx := NewTemplateContext(&Node{Name: "db", Host: "${env:SSHW_TEMPLATE_ENV}.example.com", Port: 2222})
+
+	tests := []struct {
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{src: "${file:" + secret + "}", want: "  DB-Password"},
+		{src: "${file:" + secret + " | trim | lower}", want: "db-password"},
+		{src: "${exec:printf 'a|b' | tr a A}", want: "A|b"},
+		{src: "${exec:echo c2VjcmV0 | base64decode}", want: "secret"},
+		{src: "${env:SSHW_TEMPLATE_ENV|upper}", want: "VALUE"},
+		{src: "${env:SSHW_TEMPLATE_MISSING:default}", want: "default"},
+		{src: "${SSHW_TEMPLATE_ENV | lower}", want: "value"},
+		{src: "${node:Name}@${node:host}:${node:port}", want: "db@Value.example.com:2222"},
+		{src: "${SSHW_TEMPLATE_MISSING}", want: "${SSHW_TEMPLATE_MISSING}"},
+		{src: "${env:SSHW_TEMPLATE_MISSING}", want: "${env:SSHW_TEMPLATE_MISSING}", wantErr: true},
+		{src: "${file:" + path.Join(dir, "missing") + "}", wantErr: true},
+		{src: "${exec:exit 1}", wantErr: true},
+		{src: "${node:Missing}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSshwTemplate(tt.src).ExecuteContext(ctx)
+		if tt.wantErr {
+			ast.NotNil(err, tt.src)
+			continue
+		}
+		ast.Nil(err, tt.src)
+		ast.Equal(tt.want, got, tt.src)
+	}
+
+	_, err := ParseSshwTemplate("${node:Host}").ExecuteContext(NewTemplateContext(&Node{Host: "${node:Host}"}))
+	ast.NotNil(err)
+}
+
+func Test_renderTypedTemplates(t *testing.T) {
+	ast := assert.New(t)
+	_ = os.Setenv("SSHW_TEMPLATE_PORT", "2222")
+	defer os.Unsetenv("SSHW_TEMPLATE_PORT")
+
+	nodes, err := LoadYamlConfig0([]byte(`
+- name: 主机 ${node:Name}
+  vars:
+    cm: "true"
+  children:
+    - name: db
+      host: db.example.com
+      port: "${SSHW_TEMPLATE_PORT}" # comment
+      control-master: ${cm}
+      idle-timeout: ${SSHW_TEMPLATE_IDLE:15m}
+      user: ${SSHW_TEMPLATE_USER}
+      callback-shells:
+        - cmd: ls
+          delay: ${SSHW_TEMPLATE_DELAY:1s}
+`))
+	ast.Nil(err)
+	db := nodes[0].Children[0]
+	ast.Equal(2222, db.Port)
+	ast.True(*db.ControlMaster)
+	ast.Equal(15*time.Minute, db.IdleTimeout)
+	ast.Equal(time.Second, db.CallbackShells[0].Delay)
+	// string is rendered by InitConfig
+	ast.Equal("${SSHW_TEMPLATE_USER}", db.User)
+
+	_, err = LoadYamlConfig0([]byte(`
+- name: prod
+  children:
+    - name: db
+      port: ${SSHW_TEMPLATE_MISSING}
+`))
+	ast.NotNil(err)
+	ast.Equal("line 5: [0].children[0].port: template ${SSHW_TEMPLATE_MISSING} has no value", err.Error())
+
+	_, err = LoadYamlConfig0([]byte(`
+- name: db
+  port: ${exec:echo 22}
+`))
+	ast.NotNil(err)
+	ast.Equal("line 3: [0].port: ${exec:echo 22} can not be used in int, bool and duration fields", err.Error())
+}
@@ -0,0 +1,231 @@
+package sshwctl
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// a rendered scalar in source
+type scalarEdit struct {
+	line, column int
+	value        string
+}
+
+// render templates of int, bool and duration fields before typed decoding
+// etc. `port: ${DB_PORT:22}`, `control-master: ${SSHW_CM:false}`
+// string fields are rendered later by InitConfig, they may use vars of execs-pre
+// vars of node and its parents are read before env
+// vars of defaults, global config and expanded ranges are not set yet, and
+// node, exec and file sources are rejected, they depend on the node to connect
+func renderTypedTemplates(bs []byte, t reflect.Type) ([]byte, error) {
+	if !bytes.Contains(bs, []byte("${")) {
+		return bs, nil
+	}
+	var edits []*scalarEdit
+	decoder := yamlv3.NewDecoder(bytes.NewReader(bs))
+	for {
+		doc := new(yamlv3.Node)
+		if err := decoder.Decode(doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			// typed decoding reports it
+			return bs, nil
+		}
+		for _, content := range doc.Content {
+			var docType = t
+			if content.Kind == yamlv3.SequenceNode {
+				docType = reflect.SliceOf(t)
+			}
+			if err := collectTypedTemplates(content, docType, "", nil, &edits); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(edits) == 0 {
+		return bs, nil
+	}
+	return applyScalarEdits(bs, edits), nil
+}
+
+func collectTypedTemplates(node *yamlv3.Node, t reflect.Type, fieldPath string, vars map[string]string, edits *[]*scalarEdit) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yamlv3.SequenceNode:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return nil
+		}
+		for i, child := range node.Content {
+			if err := collectTypedTemplates(child, t.Elem(), fieldPath+"["+strconv.Itoa(i)+"]", vars, edits); err != nil {
+				return err
+			}
+		}
+	case yamlv3.MappingNode:
+		if t.Kind() == reflect.Map {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if err := collectTypedTemplates(node.Content[i+1], t.Elem(), joinFieldPath(fieldPath, node.Content[i].Value), vars, edits); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		if t == nodeType.Elem() {
+			vars = yamlVars(node, vars)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			field, ok := yamlField(t, key)
+			if !ok {
+				continue
+			}
+			if err := collectTypedTemplates(node.Content[i+1], field.Type, joinFieldPath(fieldPath, key), vars, edits); err != nil {
+				return err
+			}
+		}
+	case yamlv3.ScalarNode:
+		if !isTypedKind(t.Kind()) || !strings.Contains(node.Value, "${") {
+			return nil
+		}
+		template := ParseSshwTemplate(node.Value)
+		for _, templateNode := range template.Templates {
+			if templateNode.Type != TypeParam {
+				continue
+			}
+			prefix := strings.TrimSpace(strings.SplitN(templateNode.Value[2:len(templateNode.Value)-1], ":", 2)[0])
+			if typedSourcesRejected[prefix] {
+				return errors.Errorf("line %d: %s: %s can not be used in int, bool and duration fields", node.Line, fieldPath, templateNode.Value)
+			}
+		}
+		ctx := NewTemplateContext(&Node{Vars: vars})
+		r, err := template.ExecuteContext(ctx)
+		if err == nil && strings.Contains(r, "${") {
+			err = errors.Errorf("template %s has no value", node.Value)
+		}
+		if err != nil {
+			return errors.WithMessage(err, "line "+strconv.Itoa(node.Line)+": "+fieldPath)
+		}
+		*edits = append(*edits, &scalarEdit{line: node.Line, column: node.Column, value: r})
+	}
+	return nil
+}
+
+// sources resolved by the node to connect, typed fields are decoded before it
+var typedSourcesRejected = map[string]bool{"node": true, "exec": true, "file": true}
+
+func joinFieldPath(fieldPath, key string) string {
+	if fieldPath == "" {
+		return key
+	}
+	return fieldPath + "." + key
+}
+
+func isTypedKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// field of struct by yaml name
+func yamlField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if yamlFieldName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// name of field in yaml, lower case field name without tag like yaml.v2, empty if it is skipped
+func yamlFieldName(field reflect.StructField) string {
+	tag := strings.SplitN(field.Tag.Get("yaml"), ",", 2)[0]
+	if tag == "-" {
+		return ""
+	}
+	if tag == "" {
+		return strings.ToLower(field.Name)
+	}
+	return tag
+}
+
+// vars of node mapping, override vars of parents
+func yamlVars(node *yamlv3.Node, parent map[string]string) map[string]string {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != "vars" || node.Content[i+1].Kind != yamlv3.MappingNode {
+			continue
+		}
+		vars := make(map[string]string, len(parent))
+		for k, v := range parent {
+			vars[k] = v
+		}
+		mapping := node.Content[i+1]
+		for j := 0; j+1 < len(mapping.Content); j += 2 {
+			vars[mapping.Content[j].Value] = mapping.Content[j+1].Value
+		}
+		return vars
+	}
+	return parent
+}
+
+// replace plain or quoted scalars in source, the rest of source is untouched
+func applyScalarEdits(bs []byte, edits []*scalarEdit) []byte {
+	lines := strings.SplitAfter(string(bs), "\n")
+	// replace from right, column of left edit is not moved
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line > edits[j].line
+		}
+		return edits[i].column > edits[j].column
+	})
+	for _, edit := range edits {
+		if edit.line < 1 || edit.line > len(lines) {
+			continue
+		}
+		line := lines[edit.line-1]
+		// column counts runes
+		start := len(line)
+		if runes := []rune(line); edit.column >= 1 && edit.column <= len(runes) {
+			start = len(string(runes[:edit.column-1]))
+		}
+		if start >= len(line) {
+			continue
+		}
+		end := scalarEnd(line, start)
+		lines[edit.line-1] = line[:start] + edit.value + line[end:]
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+func scalarEnd(line string, start int) int {
+	if quote := line[start]; quote == '"' || quote == '\'' {
+		if i := strings.IndexByte(line[start+1:], quote); i >= 0 {
+			return start + 1 + i + 1
+		}
+		return len(strings.TrimRight(line, "\r\n"))
+	}
+	end := len(strings.TrimRight(line, "\r\n"))
+	// plain scalar ends before comment
+	for i := start + 1; i < end; i++ {
+		if line[i] == '#' && (line[i-1] == ' ' || line[i-1] == '\t') {
+			return len(strings.TrimRight(line[:i], " \t"))
+		}
+	}
+	return end
+}
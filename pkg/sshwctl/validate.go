@@ -0,0 +1,454 @@
+package sshwctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// problem of config found by ValidateYamlConfig
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d *Diagnostic) String() string {
+	if d.Line == 0 {
+		return d.File + ": " + d.Message
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	yamlLineReg  = regexp.MustCompile(`line (\d+)`)
+	// bool of yaml 1.1, same as yaml.v2
+	yamlBools = map[string]bool{"y": true, "yes": true, "n": true, "no": true, "true": true, "false": true, "on": true, "off": true}
+)
+
+// check config like LoadYamlConfigs, team config and global config
+// it reports every problem instead of stopping at the first one, etc.
+// syntax errors, unknown keys, bad ports and durations, duplicate aliases,
+// jumps without host, nodes without host and children, templates without value
+// error is returned only if config can not be read
+func ValidateYamlConfig(filename string) ([]*Diagnostic, error) {
+	v := newConfigValidator()
+	if _, b, err := ReadConfigBytes(SshwGlobalConfigPath); err == nil {
+		v.validateFile(SshwGlobalConfigPath, b, true)
+	}
+
+	teamFiles := TeamConfigFiles()
+	for _, teamFile := range teamFiles {
+		b, err := ioutil.ReadFile(teamFile)
+		if err != nil {
+			return nil, err
+		}
+		v.validateFile(teamFile, b, false)
+	}
+
+	matches, _ := filepath.Glob(path.Join(SshwConfigDir, "*.yaml"))
+	sort.Strings(matches)
+	pathname, b, err := ReadConfigBytes(filename)
+	if err != nil {
+		if filename != "" || (len(matches) == 0 && len(teamFiles) == 0) {
+			return nil, err
+		}
+	} else if pathname != "" {
+		v.validateFile(pathname, b, false)
+	}
+	for _, match := range matches {
+		if match == pathname {
+			continue
+		}
+		b, err := ioutil.ReadFile(match)
+		if err != nil {
+			return nil, err
+		}
+		v.validateFile(match, b, false)
+	}
+	return v.diagnostics, nil
+}
+
+type configValidator struct {
+	diagnostics []*Diagnostic
+	// { [alias]: position of first node }
+	aliases map[string]string
+	// vars of global nodes, they may be matched by any node
+	globalVars map[string]string
+	// files being validated, to detect include cycle
+	stack []string
+	// files validated
+	visited map[string]bool
+}
+
+func newConfigValidator() *configValidator {
+	return &configValidator{
+		aliases:    map[string]string{},
+		globalVars: map[string]string{},
+		visited:    map[string]bool{},
+	}
+}
+
+// file being validated
+type validateFile struct {
+	pathname string
+	global   bool
+}
+
+type nodeKind int
+
+const (
+	nodeKindTree nodeKind = iota
+	nodeKindJump
+	nodeKindDefaults
+	nodeKindGlobal
+)
+
+func (v *configValidator) add(file *validateFile, node *yamlv3.Node, format string, args ...interface{}) {
+	d := &Diagnostic{File: file.pathname, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		d.Line, d.Column = node.Line, node.Column
+	}
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+func (v *configValidator) validateFile(pathname string, b []byte, global bool) {
+	for _, loading := range v.stack {
+		if loading == pathname {
+			v.add(&validateFile{pathname: v.stack[len(v.stack)-1]}, nil, "include cycle: %s", strings.Join(append(v.stack, pathname), " -> "))
+			return
+		}
+	}
+	if v.visited[pathname] {
+		return
+	}
+	v.visited[pathname] = true
+	v.stack = append(v.stack, pathname)
+	defer func() {
+		v.stack = v.stack[:len(v.stack)-1]
+	}()
+
+	file := &validateFile{pathname: pathname, global: global}
+	count := len(v.diagnostics)
+	documents, err := ParseYamlDocuments(b)
+	if err != nil {
+		v.addYamlError(file, err)
+		return
+	}
+	// lines of tree are kept
+	documents.rewriteSecretTags()
+	for _, doc := range documents.Docs {
+		for _, content := range doc.Content {
+			v.validateDocument(file, content)
+		}
+	}
+	// typed decoding may find what is missed
+	if len(v.diagnostics) == count {
+		if _, err := LoadYamlConfig0(b); err != nil {
+			v.addYamlError(file, err)
+		}
+	}
+}
+
+// error of yaml has line in message
+func (v *configValidator) addYamlError(file *validateFile, err error) {
+	d := &Diagnostic{File: file.pathname, Message: err.Error()}
+	if match := yamlLineReg.FindStringSubmatch(d.Message); len(match) == 2 {
+		d.Line, _ = strconv.Atoi(match[1])
+	}
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+func (v *configValidator) validateDocument(file *validateFile, doc *yamlv3.Node) {
+	kind := nodeKindTree
+	if file.global {
+		kind = nodeKindGlobal
+	}
+	switch doc.Kind {
+	case yamlv3.SequenceNode:
+		for _, item := range doc.Content {
+			v.validateNode(file, item, kind, v.globalVars)
+		}
+	case yamlv3.MappingNode:
+		if mappingValue(doc, "name") != nil {
+			v.validateNode(file, doc, kind, v.globalVars)
+			return
+		}
+		if file.global {
+			v.validateValue(file, doc, reflect.TypeOf(Settings{}), "", nil)
+			return
+		}
+		v.validateValue(file, doc, reflect.TypeOf(configDocument{}), "", nil)
+		if include := mappingValue(doc, "include"); include != nil {
+			v.validateIncludes(file, include)
+		}
+	default:
+		v.add(file, doc, "document is neither a node nor a list of nodes")
+	}
+}
+
+func (v *configValidator) validateNode(file *validateFile, node *yamlv3.Node, kind nodeKind, parentVars map[string]string) {
+	if node.Kind != yamlv3.MappingNode {
+		v.add(file, node, "node should be a mapping")
+		return
+	}
+	vars := nodeScopeVars(node, parentVars)
+	if kind == nodeKindGlobal {
+		for name, value := range vars {
+			v.globalVars[name] = value
+		}
+	}
+
+	var name string
+	if nameNode := mappingValue(node, "name"); nameNode != nil {
+		name = nameNode.Value
+	}
+	label := name
+	if label == "" {
+		label = "without name"
+	}
+	switch kind {
+	case nodeKindTree:
+		if name == "" {
+			v.add(file, node, "node without name is skipped")
+		}
+		host, children, include := mappingValue(node, "host"), mappingValue(node, "children"), mappingValue(node, "include")
+		if (host == nil || host.Value == "") && (children == nil || len(children.Content) == 0) && include == nil {
+			v.add(file, node, "node %s has neither host nor children", label)
+		}
+		if alias := mappingValue(node, "alias"); alias != nil && alias.Value != "" {
+			position := fmt.Sprintf("%s:%d", file.pathname, alias.Line)
+			if first, has := v.aliases[alias.Value]; has {
+				v.add(file, alias, "duplicate alias %s, it is defined at %s", alias.Value, first)
+			} else {
+				v.aliases[alias.Value] = position
+			}
+		}
+	case nodeKindJump:
+		if host := mappingValue(node, "host"); host == nil || host.Value == "" {
+			v.add(file, node, "jump %s has no host", label)
+		}
+	}
+
+	t := reflect.TypeOf(Node{})
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field, found := yamlField(t, key.Value)
+		if !found {
+			v.add(file, key, "unknown key %s of node %s", key.Value, label)
+			continue
+		}
+		switch key.Value {
+		case "children":
+			v.validateNodes(file, value, kind, vars)
+		case "jump":
+			v.validateNodes(file, value, nodeKindJump, vars)
+		case "defaults":
+			v.validateNode(file, value, nodeKindDefaults, vars)
+		case "include":
+			v.validateValue(file, value, field.Type, key.Value, vars)
+			if value.Kind == yamlv3.SequenceNode {
+				v.validateIncludes(file, value)
+			}
+		default:
+			v.validateValue(file, value, field.Type, key.Value, vars)
+		}
+	}
+}
+
+func (v *configValidator) validateNodes(file *validateFile, nodes *yamlv3.Node, kind nodeKind, vars map[string]string) {
+	if nodes.Kind != yamlv3.SequenceNode {
+		v.add(file, nodes, "should be a list of nodes")
+		return
+	}
+	for _, node := range nodes.Content {
+		v.validateNode(file, node, kind, vars)
+	}
+}
+
+func (v *configValidator) validateIncludes(file *validateFile, includes *yamlv3.Node) {
+	for _, include := range includes.Content {
+		filenames, err := resolveInclude(file.pathname, include.Value)
+		if err != nil {
+			v.add(file, include, "%v", err)
+			continue
+		}
+		for _, filename := range filenames {
+			pathname, b, err := ReadConfigBytes(filename)
+			if err != nil {
+				v.add(file, include, "include %s: %v", include.Value, err)
+				continue
+			}
+			v.validateFile(pathname, b, false)
+		}
+	}
+}
+
+// check value is decoded as t, key is the yaml key of value
+func (v *configValidator) validateValue(file *validateFile, value *yamlv3.Node, t reflect.Type, key string, vars map[string]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if value.Kind == yamlv3.AliasNode {
+		return
+	}
+	if value.Kind == yamlv3.ScalarNode && value.Tag == "!!null" {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if value.Kind != yamlv3.MappingNode {
+			v.add(file, value, "%s should be a mapping", key)
+			return
+		}
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			k := value.Content[i]
+			field, found := yamlField(t, k.Value)
+			if !found {
+				v.add(file, k, "unknown key %s", joinFieldPath(key, k.Value))
+				continue
+			}
+			v.validateValue(file, value.Content[i+1], field.Type, k.Value, vars)
+		}
+	case reflect.Map:
+		if value.Kind != yamlv3.MappingNode {
+			v.add(file, value, "%s should be a mapping", key)
+			return
+		}
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			v.validateValue(file, value.Content[i+1], t.Elem(), value.Content[i].Value, vars)
+		}
+	case reflect.Slice, reflect.Array:
+		if value.Kind != yamlv3.SequenceNode {
+			v.add(file, value, "%s should be a list", key)
+			return
+		}
+		for _, item := range value.Content {
+			v.validateValue(file, item, t.Elem(), key, vars)
+		}
+	default:
+		if value.Kind != yamlv3.ScalarNode {
+			v.add(file, value, "%s should be a scalar", key)
+			return
+		}
+		if strings.Contains(value.Value, "${") {
+			v.validateTemplates(file, value, vars)
+			return
+		}
+		v.validateScalar(file, value, t, key)
+	}
+}
+
+func (v *configValidator) validateScalar(file *validateFile, value *yamlv3.Node, t reflect.Type, key string) {
+	switch {
+	case t == durationType:
+		if _, err := strconv.ParseInt(value.Value, 10, 64); err == nil {
+			return
+		}
+		if _, err := time.ParseDuration(value.Value); err != nil {
+			v.add(file, value, "%s: invalid duration %s", key, value.Value)
+		}
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+		n, err := strconv.Atoi(value.Value)
+		if err != nil {
+			v.add(file, value, "%s: invalid integer %s", key, value.Value)
+			return
+		}
+		if key == "port" && (n <= 0 || n > 65535) {
+			v.add(file, value, "port %d should be between 1 and 65535", n)
+		}
+	case t.Kind() == reflect.Bool:
+		if !yamlBools[strings.ToLower(value.Value)] {
+			v.add(file, value, "%s: invalid bool %s", key, value.Value)
+		}
+	}
+}
+
+// ${exec:xxx}, ${node:xxx} and ${item:xxx} are not resolved, var of execs-pre has no value until connecting
+func (v *configValidator) validateTemplates(file *validateFile, value *yamlv3.Node, vars map[string]string) {
+	ctx := NewTemplateContext(&Node{Vars: vars})
+	for _, param := range ParseSshwTemplate(value.Value).Templates {
+		if param.Type != TypeParam {
+			continue
+		}
+		expr := param.Value[2 : len(param.Value)-1]
+		if prefix := strings.SplitN(expr, ":", 2)[0]; prefix == "exec" || prefix == "node" || prefix == "item" {
+			continue
+		}
+		if _, found, err := ctx.resolve(expr); err != nil {
+			v.add(file, value, "template %s: %v", param.Value, err)
+		} else if !found {
+			v.add(file, value, "template %s has no value", param.Value)
+		}
+	}
+}
+
+// vars of parents, vars and var of execs-pre of node, and vars of defaults for children
+func nodeScopeVars(node *yamlv3.Node, parentVars map[string]string) map[string]string {
+	vars := make(map[string]string, len(parentVars))
+	for name, value := range parentVars {
+		vars[name] = value
+	}
+	// values of range, for-each and ranges of host take the next unused vars, see expand.go
+	count := 0
+	if r := mappingValue(node, "range"); r != nil && r.Value != "" {
+		count++
+	}
+	if forEach := mappingValue(node, "for-each"); forEach != nil && len(forEach.Content) != 0 {
+		count++
+	}
+	if host := mappingValue(node, "host"); host != nil {
+		count += len(hostRangeRegexp.FindAllString(host.Value, -1))
+	}
+	for _, name := range expandVars {
+		if _, has := vars[name]; !has && count > 0 {
+			vars[name] = ""
+			count--
+		}
+	}
+	if defaults := mappingValue(node, "defaults"); defaults != nil {
+		addYamlVars(vars, mappingValue(defaults, "vars"))
+	}
+	addYamlVars(vars, mappingValue(node, "vars"))
+	if execs := mappingValue(node, "execs-pre"); execs != nil {
+		for _, exec := range execs.Content {
+			if name := mappingValue(exec, "var"); name != nil && name.Value != "" {
+				vars[name.Value] = ""
+			}
+		}
+	}
+	return vars
+}
+
+func addYamlVars(vars map[string]string, mapping *yamlv3.Node) {
+	if mapping == nil || mapping.Kind != yamlv3.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		vars[mapping.Content[i].Value] = mapping.Content[i+1].Value
+	}
+}
+
+// value of key in mapping, nil if mapping has no key
+func mappingValue(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	if mapping == nil || mapping.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package sshwctl
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateYamlConfig(t *testing.T) {
+	ast := assert.New(t)
+	dir, _ := ioutil.TempDir("", "sshw")
+	defer os.RemoveAll(dir)
+	configDir := SshwConfigDir
+	SshwConfigDir = path.Join(dir, "config.d")
+	defer func() {
+		SshwConfigDir = configDir
+	}()
+
+	_ = ioutil.WriteFile(path.Join(dir, "team.yaml"), []byte(`
+- name: team
+  alias: web
+  host: 10.0.0.9
+`), 0644)
+	filename := path.Join(dir, "sshw.yaml")
+	_ = ioutil.WriteFile(filename, []byte(`include: [team.yaml]
+---
+- name: prod
+  vars:
+    user: deploy
+  children:
+    - name: web
+      alias: web
+      host: 10.0.0.1
+      user: ${user}
+      password: ${SSHW_VALIDATE_MISSING}
+      port: 70000
+      idle-timeout: 15x
+      hots: typo
+      jump:
+        - user: jump
+    - name: empty
+    - host: 10.0.0.2
+    - name: db
+      host: 10.0.0.3
+      execs-pre:
+        - cmd: echo secret
+          var: db_pass
+      password: ${db_pass}
+      control-master: maybe
+`), 0644)
+	diagnostics, err := ValidateYamlConfig(filename)
+	ast.Nil(err)
+	var messages []string
+	for _, d := range diagnostics {
+		messages = append(messages, d.String())
+	}
+	ast.Equal([]string{
+		filename + ":8:14: duplicate alias web, it is defined at " + path.Join(dir, "team.yaml") + ":3",
+		filename + ":11:17: template ${SSHW_VALIDATE_MISSING} has no value",
+		filename + ":12:13: port 70000 should be between 1 and 65535",
+		filename + ":13:21: idle-timeout: invalid duration 15x",
+		filename + ":14:7: unknown key hots of node web",
+		filename + ":16:11: jump without name has no host",
+		filename + ":17:7: node empty has neither host nor children",
+		filename + ":18:7: node without name is skipped",
+		filename + ":25:23: control-master: invalid bool maybe",
+	}, messages)
+
+	// vars of expanded nodes
+	_ = ioutil.WriteFile(filename, []byte(`
+- name: ${i}
+  for-each: [eu, us]
+  children:
+    - name: web-${j}
+      host: web[01-12].${i}.example.com
+      keypath: ~/.ssh/${k}
+`), 0644)
+	diagnostics, err = ValidateYamlConfig(filename)
+	ast.Nil(err)
+	ast.Len(diagnostics, 1)
+	ast.Equal("template ${k} has no value", diagnostics[0].Message)
+
+	_ = ioutil.WriteFile(filename, []byte("- name: a\n  host: [\n"), 0644)
+	diagnostics, err = ValidateYamlConfig(filename)
+	ast.Nil(err)
+	ast.Len(diagnostics, 1)
+	ast.Equal(2, diagnostics[0].Line)
+
+	_, err = ValidateYamlConfig(path.Join(dir, "missing.yaml"))
+	ast.NotNil(err)
+}
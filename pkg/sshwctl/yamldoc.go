@@ -0,0 +1,94 @@
+package sshwctl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// yaml file as node tree, rewrite it without losing comments, order and anchors
+type YamlDocuments struct {
+	Docs   []*yamlv3.Node
+	Indent int
+}
+
+func ParseYamlDocuments(bs []byte) (*YamlDocuments, error) {
+	documents := &YamlDocuments{Indent: detectIndent(bs)}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(bs))
+	for {
+		doc := new(yamlv3.Node)
+		if err := decoder.Decode(doc); err != nil {
+			if err == io.EOF {
+				return documents, nil
+			}
+			return nil, err
+		}
+		documents.Docs = append(documents.Docs, doc)
+	}
+}
+
+func (d *YamlDocuments) Bytes() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	encoder := yamlv3.NewEncoder(buf)
+	encoder.SetIndent(d.Indent)
+	for _, doc := range d.Docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// call fn with every scalar value of mapping, key is key of the value
+func (d *YamlDocuments) WalkScalars(fn func(key string, value *yamlv3.Node) error) error {
+	for _, doc := range d.Docs {
+		if err := walkYamlScalars(doc, "", fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkYamlScalars(node *yamlv3.Node, key string, fn func(key string, value *yamlv3.Node) error) error {
+	switch node.Kind {
+	case yamlv3.DocumentNode, yamlv3.SequenceNode:
+		for _, child := range node.Content {
+			if err := walkYamlScalars(child, key, fn); err != nil {
+				return err
+			}
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := walkYamlScalars(node.Content[i+1], node.Content[i].Value, fn); err != nil {
+				return err
+			}
+		}
+	case yamlv3.ScalarNode:
+		if key != "" {
+			return fn(key, node)
+		}
+	}
+	return nil
+}
+
+// indent of first nested line, default 2
+func detectIndent(bs []byte) int {
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+		if indent := len(line) - len(trimmed); indent > 0 {
+			return indent
+		}
+	}
+	return 2
+}
@@ -0,0 +1,359 @@
+package sshwctl
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// edit nodes of YamlDocuments, comments, order and anchors of the rest are kept
+// node is addressed by names separated by /, etc. prod/web
+
+// node in documents
+type yamlNodeRef struct {
+	// document of node, if node is a document itself
+	doc *yamlv3.Node
+	// sequence of node
+	list  *yamlv3.Node
+	index int
+	node  *yamlv3.Node
+}
+
+func SplitNodePath(p string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(p, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.Errorf("invalid node path %s", p)
+	}
+	return names, nil
+}
+
+func (d *YamlDocuments) findNode(names []string) (*yamlNodeRef, error) {
+	var ref *yamlNodeRef
+	for _, doc := range d.Docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		content := doc.Content[0]
+		if content.Kind == yamlv3.MappingNode && nodeName(content) == names[0] {
+			ref = &yamlNodeRef{doc: doc, node: content}
+			break
+		}
+		if ref = findInList(content, names[0]); ref != nil {
+			break
+		}
+	}
+	for i := 1; ref != nil && i < len(names); i++ {
+		ref = findInList(mappingValue(ref.node, "children"), names[i])
+		if ref == nil {
+			return nil, errors.Errorf("node %s is not found", strings.Join(names[:i+1], "/"))
+		}
+	}
+	if ref == nil {
+		return nil, errors.Errorf("node %s is not found", names[0])
+	}
+	return ref, nil
+}
+
+func findInList(list *yamlv3.Node, name string) *yamlNodeRef {
+	if list == nil || list.Kind != yamlv3.SequenceNode {
+		return nil
+	}
+	for i, item := range list.Content {
+		if item.Kind == yamlv3.MappingNode && nodeName(item) == name {
+			return &yamlNodeRef{list: list, index: i, node: item}
+		}
+	}
+	return nil
+}
+
+func nodeName(mapping *yamlv3.Node) string {
+	if name := mappingValue(mapping, "name"); name != nil {
+		return name.Value
+	}
+	return ""
+}
+
+// sequence where node of names is added, children of bookmark is created if it has none
+func (d *YamlDocuments) nodeList(names []string) (*yamlv3.Node, error) {
+	if len(names) == 1 {
+		for _, doc := range d.Docs {
+			if len(doc.Content) != 0 && doc.Content[0].Kind == yamlv3.SequenceNode {
+				return doc.Content[0], nil
+			}
+		}
+		list := &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+		d.Docs = append(d.Docs, &yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{list}})
+		return list, nil
+	}
+	parent, err := d.findNode(names[:len(names)-1])
+	if err != nil {
+		return nil, err
+	}
+	children := mappingValue(parent.node, "children")
+	if children == nil {
+		children = &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+		setMappingValue(parent.node, "children", children)
+	}
+	if children.Kind != yamlv3.SequenceNode {
+		return nil, errors.Errorf("children of %s is not a list", strings.Join(names[:len(names)-1], "/"))
+	}
+	return children, nil
+}
+
+func (d *YamlDocuments) insertNode(names []string, node *yamlv3.Node) error {
+	if _, err := d.findNode(names); err == nil {
+		return errors.Errorf("node %s exists", strings.Join(names, "/"))
+	}
+	list, err := d.nodeList(names)
+	if err != nil {
+		return err
+	}
+	list.Content = append(list.Content, node)
+	return nil
+}
+
+// add node of path with fields, fields are in order of keys
+func (d *YamlDocuments) AddNode(p string, keys []string, fields map[string]string) error {
+	names, err := SplitNodePath(p)
+	if err != nil {
+		return err
+	}
+	node := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	setMappingValue(node, "name", &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: names[len(names)-1]})
+	for _, key := range keys {
+		value, err := nodeFieldValue(key, fields[key])
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			setMappingValue(node, key, value)
+		}
+	}
+	return d.insertNode(names, node)
+}
+
+// set field of node, empty value removes the field
+// list of strings is separated by comma, etc. tags=db,prod
+func (d *YamlDocuments) SetNodeField(p, key, value string) error {
+	names, err := SplitNodePath(p)
+	if err != nil {
+		return err
+	}
+	ref, err := d.findNode(names)
+	if err != nil {
+		return err
+	}
+	if key == "name" {
+		newNames := append([]string{}, names[:len(names)-1]...)
+		return d.MoveNode(p, strings.Join(append(newNames, value), "/"))
+	}
+	v, err := nodeFieldValue(key, value)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if value := mappingValue(ref.node, key); value != nil {
+			if err := d.checkAnchors(p+" "+key, value); err != nil {
+				return err
+			}
+		}
+		deleteMappingValue(ref.node, key)
+		return nil
+	}
+	setMappingValue(ref.node, key, v)
+	return nil
+}
+
+func (d *YamlDocuments) RemoveNode(p string) error {
+	names, err := SplitNodePath(p)
+	if err != nil {
+		return err
+	}
+	ref, err := d.findNode(names)
+	if err != nil {
+		return err
+	}
+	if err := d.checkAnchors(p, ref.node); err != nil {
+		return err
+	}
+	d.removeRef(ref)
+	return nil
+}
+
+// node and its descendants must not define anchors referenced by aliases out of it
+// aliases would point at nothing after node is removed, or before their anchor after it is moved
+func (d *YamlDocuments) checkAnchors(p string, node *yamlv3.Node) error {
+	anchors := make(map[*yamlv3.Node]bool)
+	walkYamlNodes(node, func(n *yamlv3.Node) bool {
+		if n.Anchor != "" {
+			anchors[n] = true
+		}
+		return true
+	})
+	if len(anchors) == 0 {
+		return nil
+	}
+	for _, doc := range d.Docs {
+		var alias *yamlv3.Node
+		walkYamlNodes(doc, func(n *yamlv3.Node) bool {
+			if n == node || alias != nil {
+				return false
+			}
+			if n.Kind == yamlv3.AliasNode && anchors[n.Alias] {
+				alias = n
+			}
+			return true
+		})
+		if alias != nil {
+			return errors.Errorf("%s defines anchor %s, it is referenced at line %d, edit config instead", p, alias.Value, alias.Line)
+		}
+	}
+	return nil
+}
+
+// node and its descendants, children are skipped if f returns false, aliases are not followed
+func walkYamlNodes(node *yamlv3.Node, f func(n *yamlv3.Node) bool) {
+	if !f(node) {
+		return
+	}
+	for _, child := range node.Content {
+		walkYamlNodes(child, f)
+	}
+}
+
+func (d *YamlDocuments) removeRef(ref *yamlNodeRef) {
+	if ref.doc != nil {
+		for i, doc := range d.Docs {
+			if doc == ref.doc {
+				d.Docs = append(d.Docs[:i], d.Docs[i+1:]...)
+				return
+			}
+		}
+	}
+	ref.list.Content = append(ref.list.Content[:ref.index], ref.list.Content[ref.index+1:]...)
+}
+
+// move node to new path, its name is the last name of new path
+func (d *YamlDocuments) MoveNode(p, newPath string) error {
+	names, err := SplitNodePath(p)
+	if err != nil {
+		return err
+	}
+	newNames, err := SplitNodePath(newPath)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(strings.Join(newNames, "/")+"/", strings.Join(names, "/")+"/") {
+		return errors.Errorf("can not move %s into itself", p)
+	}
+	ref, err := d.findNode(names)
+	if err != nil {
+		return err
+	}
+	if err := d.checkAnchors(p, ref.node); err != nil {
+		return err
+	}
+	if _, err := d.findNode(newNames); err == nil {
+		return errors.Errorf("node %s exists", newPath)
+	}
+	// parent must exist before node is removed
+	if len(newNames) > 1 {
+		if _, err := d.findNode(newNames[:len(newNames)-1]); err != nil {
+			return err
+		}
+	}
+	d.removeRef(ref)
+	name := mappingValue(ref.node, "name")
+	name.Value = newNames[len(newNames)-1]
+	return d.insertNode(newNames, ref.node)
+}
+
+// yaml value of field, nil if value is empty
+func nodeFieldValue(key, value string) (*yamlv3.Node, error) {
+	field, found := yamlField(nodeType.Elem(), key)
+	if !found {
+		return nil, errors.Errorf("unknown key %s", key)
+	}
+	if value == "" {
+		return nil, nil
+	}
+	t := field.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	scalar := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: value}
+	// typed field may be template, see template_yaml.go
+	if strings.Contains(value, "${") && t.Kind() != reflect.Slice {
+		return scalar, nil
+	}
+	switch {
+	case t == durationType:
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, errors.Errorf("%s: invalid duration %s", key, value)
+		}
+	case t.Kind() == reflect.String:
+	case t.Kind() == reflect.Int:
+		if _, err := strconv.Atoi(value); err != nil {
+			return nil, errors.Errorf("%s: invalid integer %s", key, value)
+		}
+		scalar.Tag = "!!int"
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			if !yamlBools[strings.ToLower(value)] {
+				return nil, errors.Errorf("%s: invalid bool %s", key, value)
+			}
+			b = yamlTrue[strings.ToLower(value)]
+		}
+		scalar.Tag, scalar.Value = "!!bool", strconv.FormatBool(b)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		list := &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq", Style: yamlv3.FlowStyle}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list.Content = append(list.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+		return list, nil
+	default:
+		return nil, errors.Errorf("%s can not be set by command, edit config instead", key)
+	}
+	return scalar, nil
+}
+
+var yamlTrue = map[string]bool{"y": true, "yes": true, "true": true, "on": true}
+
+// comments and anchor of old value are kept, aliases of the anchor read the new value
+func setMappingValue(mapping *yamlv3.Node, key string, value *yamlv3.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			old := mapping.Content[i+1]
+			if old.Kind == value.Kind {
+				value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+			}
+			if value.Anchor == "" {
+				value.Anchor = old.Anchor
+			}
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func deleteMappingValue(mapping *yamlv3.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sshwctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYamlDocuments_EditNode(t *testing.T) {
+	ast := assert.New(t)
+	documents, err := ParseYamlDocuments([]byte(`# team config
+- name: prod
+  # bookmark of prod
+  children:
+    - name: web
+      host: 10.0.0.1 # primary
+      user: &user deploy
+    - name: db
+      host: 10.0.0.2
+      user: *user
+- name: test
+  host: 10.0.1.1
+`))
+	ast.Nil(err)
+
+	ast.Nil(documents.AddNode("prod/cache", []string{"host", "port", "tags"}, map[string]string{"host": "10.0.0.3", "port": "6379", "tags": "redis, prod"}))
+	ast.NotNil(documents.AddNode("prod/web", nil, nil))
+	ast.NotNil(documents.AddNode("stage/web", nil, nil))
+	ast.NotNil(documents.AddNode("prod/x", []string{"port"}, map[string]string{"port": "abc"}))
+	ast.NotNil(documents.AddNode("prod/x", []string{"hots"}, map[string]string{"hots": "abc"}))
+
+	ast.Nil(documents.SetNodeField("prod/web", "host", "10.0.0.10"))
+	ast.Nil(documents.SetNodeField("prod/web", "control-master", "yes"))
+	ast.Nil(documents.SetNodeField("prod/web", "port", "${WEB_PORT:22}"))
+	ast.Nil(documents.SetNodeField("test", "host", ""))
+	ast.Nil(documents.SetNodeField("test", "children", ""))
+	ast.NotNil(documents.SetNodeField("test", "jump", "a"))
+
+	ast.Nil(documents.MoveNode("prod/db", "test/db"))
+	ast.NotNil(documents.MoveNode("prod", "prod/x"))
+	ast.NotNil(documents.MoveNode("prod/web", "missing/web"))
+	ast.Nil(documents.RemoveNode("prod/cache"))
+	ast.NotNil(documents.RemoveNode("prod/cache"))
+	ast.Nil(documents.AddNode("stage", []string{"host"}, map[string]string{"host": "10.0.2.1"}))
+
+	b, err := documents.Bytes()
+	ast.Nil(err)
+	ast.Equal(`# team config
+- name: prod
+  # bookmark of prod
+  children:
+    - name: web
+      host: 10.0.0.10 # primary
+      user: &user deploy
+      control-master: true
+      port: ${WEB_PORT:22}
+- name: test
+  children:
+    - name: db
+      host: 10.0.0.2
+      user: *user
+- name: stage
+  host: 10.0.2.1
+`, string(b))
+}
+
+func TestYamlDocuments_EditAnchoredNode(t *testing.T) {
+	ast := assert.New(t)
+	documents, err := ParseYamlDocuments([]byte(`- name: prod
+  children:
+    - name: web
+      host: 10.0.0.1
+      user: &user deploy
+    - name: db
+      host: 10.0.0.2
+      user: *user
+`))
+	ast.Nil(err)
+
+	// aliases of web would point at nothing
+	err = documents.RemoveNode("prod/web")
+	ast.NotNil(err)
+	ast.Equal("prod/web defines anchor user, it is referenced at line 8, edit config instead", err.Error())
+	ast.NotNil(documents.MoveNode("prod/web", "web"))
+	ast.NotNil(documents.SetNodeField("prod/web", "user", ""))
+
+	// anchor is kept, aliases read the new value
+	ast.Nil(documents.SetNodeField("prod/web", "user", "root"))
+	ast.Nil(documents.RemoveNode("prod/db"))
+	ast.Nil(documents.RemoveNode("prod/web"))
+	b, err := documents.Bytes()
+	ast.Nil(err)
+	_, err = ParseYamlDocuments(b)
+	ast.Nil(err)
+
+	documents, _ = ParseYamlDocuments([]byte(`- name: web
+  user: &user deploy
+- name: db
+  user: *user
+`))
+	ast.Nil(documents.SetNodeField("web", "user", "root"))
+	b, err = documents.Bytes()
+	ast.Nil(err)
+	nodes, err := LoadYamlConfig0(b)
+	ast.Nil(err)
+	ast.Equal("root", nodes[1].User)
+}
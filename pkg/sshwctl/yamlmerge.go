@@ -0,0 +1,259 @@
+package sshwctl
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// upstream config merged into local last time, it is the base of three-way merge
+// every local file has its own base of an upstream, a new local file has none
+func MergeBasePath(local, upstream string) string {
+	sum := sha1.Sum([]byte(local + "\n" + upstream))
+	return path.Join(SshwDir, "merge-base", hex.EncodeToString(sum[:8])+".yaml")
+}
+
+const (
+	MergeKeepLocal    = "local"
+	MergeKeepUpstream = "upstream"
+)
+
+// field changed on both sides
+type MergeConflict struct {
+	Path     string
+	Key      string
+	Local    string
+	Upstream string
+	// MergeKeepLocal or MergeKeepUpstream
+	Keep string
+}
+
+func (c *MergeConflict) String() string {
+	return fmt.Sprintf("%s %s: local %s, upstream %s, keep %s", c.Path, c.Key, c.Local, c.Upstream, c.Keep)
+}
+
+type MergeReport struct {
+	// paths of nodes
+	Added   []string
+	Removed []string
+	// `path key` of fields
+	Updated   []string
+	Conflicts []*MergeConflict
+}
+
+// merge nodes of upstream into local field by field, nodes are matched by name like MergeNodes
+// with base, it is a three-way merge, changes of one side are applied, and local is kept if both changed
+// without base, upstream is used if both sides are different
+// comments, order and anchors of local are kept
+func MergeYamlDocuments(local, upstream, base *YamlDocuments) *MergeReport {
+	m := &yamlMerger{local: local, hasBase: base != nil, report: new(MergeReport)}
+	var baseNodes []*yamlv3.Node
+	if base != nil {
+		baseNodes = topYamlNodes(base)
+	}
+	m.mergeList(topYamlNodes(local), topYamlNodes(upstream), baseNodes, "", func(node *yamlv3.Node) {
+		list, _ := local.nodeList([]string{nodeName(node)})
+		list.Content = append(list.Content, node)
+	}, func(node *yamlv3.Node) {
+		if ref, err := local.findNode([]string{nodeName(node)}); err == nil {
+			local.removeRef(ref)
+		}
+	})
+	return m.report
+}
+
+type yamlMerger struct {
+	local   *YamlDocuments
+	hasBase bool
+	report  *MergeReport
+}
+
+func (m *yamlMerger) mergeList(locals, upstreams, bases []*yamlv3.Node, prefix string, add, remove func(node *yamlv3.Node)) {
+	for _, upstream := range upstreams {
+		if ignore := mappingValue(upstream, "merge-ignore"); ignore != nil && yamlTrue[strings.ToLower(ignore.Value)] {
+			continue
+		}
+		name := nodeName(upstream)
+		p := joinNodePath(prefix, name)
+		local, base := findYamlNode(locals, name), findYamlNode(bases, name)
+		switch {
+		case local != nil:
+			m.mergeNode(local, upstream, base, p)
+		case base != nil:
+			// removed locally
+		default:
+			add(detachYamlNode(upstream))
+			m.report.Added = append(m.report.Added, p)
+		}
+	}
+	for _, base := range bases {
+		name := nodeName(base)
+		local := findYamlNode(locals, name)
+		if local == nil || findYamlNode(upstreams, name) != nil {
+			continue
+		}
+		p := joinNodePath(prefix, name)
+		if yamlEqual(local, base) {
+			remove(local)
+			m.report.Removed = append(m.report.Removed, p)
+		} else {
+			m.report.Conflicts = append(m.report.Conflicts, &MergeConflict{Path: p, Key: "node", Local: "changed", Upstream: "removed", Keep: MergeKeepLocal})
+		}
+	}
+}
+
+func (m *yamlMerger) mergeNode(local, upstream, base *yamlv3.Node, p string) {
+	for i := 0; i+1 < len(upstream.Content); i += 2 {
+		key := upstream.Content[i].Value
+		if key == "name" || key == "children" || key == "merge-ignore" {
+			continue
+		}
+		upstreamValue, localValue, baseValue := upstream.Content[i+1], mappingValue(local, key), mappingValue(base, key)
+		switch {
+		case localValue != nil && yamlEqual(localValue, upstreamValue):
+		case baseValue != nil && yamlEqual(upstreamValue, baseValue):
+			// only changed locally
+		case localValue == nil && baseValue == nil:
+			setMappingValue(local, key, detachYamlNode(upstreamValue))
+			m.report.Updated = append(m.report.Updated, p+" "+key)
+		case localValue != nil && baseValue != nil && yamlEqual(localValue, baseValue):
+			setMappingValue(local, key, detachYamlNode(upstreamValue))
+			m.report.Updated = append(m.report.Updated, p+" "+key)
+		default:
+			conflict := &MergeConflict{Path: p, Key: key, Local: yamlString(localValue), Upstream: yamlString(upstreamValue), Keep: MergeKeepLocal}
+			if !m.hasBase && localValue != nil {
+				conflict.Keep = MergeKeepUpstream
+				setMappingValue(local, key, detachYamlNode(upstreamValue))
+			}
+			m.report.Conflicts = append(m.report.Conflicts, conflict)
+		}
+	}
+	// removed by upstream
+	for i := 0; base != nil && i+1 < len(base.Content); i += 2 {
+		key := base.Content[i].Value
+		if key == "name" || key == "children" || mappingValue(upstream, key) != nil {
+			continue
+		}
+		if localValue := mappingValue(local, key); localValue != nil && yamlEqual(localValue, base.Content[i+1]) {
+			deleteMappingValue(local, key)
+			m.report.Updated = append(m.report.Updated, p+" "+key)
+		}
+	}
+
+	upstreamChildren := yamlChildren(upstream)
+	if len(upstreamChildren) == 0 && len(yamlChildren(base)) == 0 {
+		return
+	}
+	children := mappingValue(local, "children")
+	if children == nil {
+		children = &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+		setMappingValue(local, "children", children)
+	}
+	if children.Kind != yamlv3.SequenceNode {
+		return
+	}
+	m.mergeList(yamlChildren(local), upstreamChildren, yamlChildren(base), p, func(node *yamlv3.Node) {
+		children.Content = append(children.Content, node)
+	}, func(node *yamlv3.Node) {
+		for i, child := range children.Content {
+			if child == node {
+				children.Content = append(children.Content[:i], children.Content[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// nodes of documents, sequences and mappings with name
+func topYamlNodes(d *YamlDocuments) []*yamlv3.Node {
+	var nodes []*yamlv3.Node
+	for _, doc := range d.Docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		content := doc.Content[0]
+		switch content.Kind {
+		case yamlv3.SequenceNode:
+			for _, item := range content.Content {
+				if item.Kind == yamlv3.MappingNode {
+					nodes = append(nodes, item)
+				}
+			}
+		case yamlv3.MappingNode:
+			if mappingValue(content, "name") != nil {
+				nodes = append(nodes, content)
+			}
+		}
+	}
+	return nodes
+}
+
+func yamlChildren(node *yamlv3.Node) []*yamlv3.Node {
+	var nodes []*yamlv3.Node
+	if children := mappingValue(node, "children"); children != nil && children.Kind == yamlv3.SequenceNode {
+		for _, child := range children.Content {
+			if child.Kind == yamlv3.MappingNode {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	return nodes
+}
+
+func findYamlNode(nodes []*yamlv3.Node, name string) *yamlv3.Node {
+	for _, node := range nodes {
+		if nodeName(node) == name {
+			return node
+		}
+	}
+	return nil
+}
+
+func joinNodePath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// equal values after aliases are resolved
+func yamlEqual(a, b *yamlv3.Node) bool {
+	var av, bv interface{}
+	if a.Decode(&av) != nil || b.Decode(&bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func yamlString(node *yamlv3.Node) string {
+	if node == nil {
+		return "<none>"
+	}
+	if node.Kind == yamlv3.ScalarNode {
+		return node.Value
+	}
+	b, err := yamlv3.Marshal(detachYamlNode(node))
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// copy node into another document, aliases are replaced by values and anchors are dropped
+func detachYamlNode(node *yamlv3.Node) *yamlv3.Node {
+	if node.Kind == yamlv3.AliasNode && node.Alias != nil {
+		return detachYamlNode(node.Alias)
+	}
+	c := *node
+	c.Anchor = ""
+	c.Content = nil
+	for _, child := range node.Content {
+		c.Content = append(c.Content, detachYamlNode(child))
+	}
+	return &c
+}
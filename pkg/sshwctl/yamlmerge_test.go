@@ -0,0 +1,128 @@
+package sshwctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeYamlDocuments(t *testing.T) {
+	ast := assert.New(t)
+	parse := func(s string) *YamlDocuments {
+		documents, err := ParseYamlDocuments([]byte(s))
+		ast.Nil(err)
+		return documents
+	}
+	base := `
+- name: prod
+  children:
+    - name: web
+      host: 10.0.0.1
+      port: 22
+      user: deploy
+    - name: db
+      host: 10.0.0.2
+    - name: old
+      host: 10.0.0.9
+`
+	local := `# my config
+- name: prod
+  children:
+    - name: web
+      host: 10.0.0.1
+      port: 2222 # my tunnel
+      user: me
+    - name: db
+      host: 10.0.0.2
+    - name: old
+      host: 10.0.0.9
+- name: mine
+  host: 127.0.0.1
+`
+	upstream := `
+- name: prod
+  children:
+    - name: web
+      host: 10.0.0.11
+      port: 22
+      user: admin
+      keypath: &key ~/.ssh/team
+    - name: db
+      host: 10.0.0.2
+      keypath: *key
+    - name: cache
+      host: 10.0.0.3
+`
+
+	// three-way
+	documents := parse(local)
+	report := MergeYamlDocuments(documents, parse(upstream), parse(base))
+	b, err := documents.Bytes()
+	ast.Nil(err)
+	ast.Equal(`# my config
+- name: prod
+  children:
+    - name: web
+      host: 10.0.0.11
+      port: 2222 # my tunnel
+      user: me
+      keypath: ~/.ssh/team
+    - name: db
+      host: 10.0.0.2
+      keypath: ~/.ssh/team
+    - name: cache
+      host: 10.0.0.3
+- name: mine
+  host: 127.0.0.1
+`, string(b))
+	ast.Equal([]string{"prod/cache"}, report.Added)
+	ast.Equal([]string{"prod/old"}, report.Removed)
+	ast.Equal([]string{"prod/web host", "prod/web keypath", "prod/db keypath"}, report.Updated)
+	ast.Len(report.Conflicts, 1)
+	ast.Equal("prod/web user: local me, upstream admin, keep local", report.Conflicts[0].String())
+
+	// without base, upstream is used
+	documents = parse(local)
+	report = MergeYamlDocuments(documents, parse(upstream), nil)
+	ast.Empty(report.Removed)
+	ast.Len(report.Conflicts, 3)
+	ast.Equal("prod/web port: local 2222, upstream 22, keep upstream", report.Conflicts[1].String())
+	nodes, err := LoadYamlConfig0(mustBytes(documents))
+	ast.Nil(err)
+	ast.Equal(22, nodes[0].Children[0].Port)
+	ast.Equal("admin", nodes[0].Children[0].User)
+	ast.Equal("old", nodes[0].Children[2].Name)
+	ast.Equal("mine", nodes[1].Name)
+
+	// merge-ignore is a bool of yaml.v2
+	for _, ignore := range []string{"true", "yes", "True", "on"} {
+		documents = parse(local)
+		report = MergeYamlDocuments(documents, parse("- {name: team, host: 10.0.0.4, merge-ignore: "+ignore+"}\n"), nil)
+		ast.Empty(report.Added, ignore)
+	}
+	documents = parse(local)
+	report = MergeYamlDocuments(documents, parse("- {name: team, host: 10.0.0.4, merge-ignore: no}\n"), nil)
+	ast.Equal([]string{"team"}, report.Added)
+
+	// anchor of replaced local value is kept
+	documents = parse("- {name: web, user: &user me}\n- {name: db, user: *user}\n")
+	MergeYamlDocuments(documents, parse("- {name: web, user: admin}\n"), nil)
+	nodes, err = LoadYamlConfig0(mustBytes(documents))
+	ast.Nil(err)
+	ast.Equal("admin", nodes[1].User)
+}
+
+func TestMergeBasePath(t *testing.T) {
+	ast := assert.New(t)
+	// base of an upstream is not shared by local files
+	ast.NotEqual(MergeBasePath("/a/.sshw.yml", "team.yml"), MergeBasePath("/b/.sshw.yml", "team.yml"))
+	ast.Equal(MergeBasePath("/a/.sshw.yml", "team.yml"), MergeBasePath("/a/.sshw.yml", "team.yml"))
+}
+
+func mustBytes(documents *YamlDocuments) []byte {
+	b, err := documents.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}